@@ -1,23 +1,34 @@
 package main
 
 import (
+	crand "crypto/rand"
+	"encoding/hex"
 	"flag"
 	"fmt"
 	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
 	"github.com/pkg/errors"
 	"github.com/spf13/pflag"
+	"golang.org/x/term"
+	"io"
 	"io/ioutil"
 	"log"
 	"math/rand"
 	"neobench/pkg/neobench"
 	"neobench/pkg/neobench/builtin"
 	"os"
+	"os/exec"
+	"runtime"
+	"runtime/debug"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// Set at build time via -ldflags "-X main.version=..."
+var version = "dev"
+
 var fInitMode bool
 var fLatencyMode bool
 var fScale int64
@@ -28,16 +39,54 @@ var fUser string
 var fPassword string
 var fEncryptionMode string
 var fDuration time.Duration
-var fProgress time.Duration
+var fWarmup time.Duration
+var fAbortAfterFailures int64
+var fMaxInFlight int
+var fChecksumResults string
+var fTransactionMode string
+var fErrorRules []string
+var errorRules neobench.ErrorRules
+var fRetriableCodes []string
+var retriableCodes neobench.RetriableCodes
+var fLatencyTargets []string
+var latencyTargets []neobench.LatencyTarget
+var fCooldown time.Duration
+var fBetweenPhasesCmd string
+var fProgress = neobench.ProgressTrigger{Interval: 10 * time.Second}
 var fVariables map[string]string
 var fBuiltinWorkloads []string
 var fWorkloadFiles []string
 var fWorkloadScripts []string
+var fSchemaFiles []string
 var fOutputFormat string
 var fPrometheusAddr string
+var fServerMetricsUrl string
 var fNoCheckCertificates bool
 var fDriverDebugLogging bool
 var fMaxConnLifetime time.Duration
+var fLivenessCheck time.Duration
+var fVersion bool
+var fLatencySampleRate float64
+var fReadOnly bool
+var fRunId string
+var fScenarioNote string
+var fIsolateScripts bool
+var fSequential bool
+var fResultsBuffer int
+var fVerbose bool
+var fProfileSlowest bool
+var fLatencyBreakdown bool
+var fLatencyResolution time.Duration
+var fOutputFile string
+var fCsvMetadata bool
+var fCsvColumns []string
+var fJsonQuantiles []float64
+var fLocale string
+var fSaveResult string
+var fCompress bool
+var fFlushInterval time.Duration
+var fRecordParams string
+var fReplayParams string
 
 func init() {
 	pflag.BoolVarP(&fInitMode, "init", "i", false, "when running built-in workloads, run their built-in dataset generator first")
@@ -45,25 +94,61 @@ func init() {
 	pflag.IntVarP(&fClients, "clients", "c", 1, "number of concurrent clients / sessions")
 	pflag.StringVarP(&fAddress, "address", "a", "neo4j://localhost:7687", "address to connect to")
 	pflag.StringVarP(&fUser, "user", "u", "neo4j", "username")
-	pflag.StringVarP(&fPassword, "password", "p", "neo4j", "password")
+	pflag.StringVarP(&fPassword, "password", "p", "", "password; if not set, read from $NEO4J_PASSWORD, or prompted for when stdin is a terminal, or else neo4j")
 	pflag.StringVarP(&fEncryptionMode, "encryption", "e", "auto", "whether to use encryption, `auto`, `true` or `false`")
-	pflag.DurationVarP(&fDuration, "duration", "d", 60*time.Second, "duration to run, ex: 15s, 1m, 10h")
+	pflag.DurationVarP(&fDuration, "duration", "d", 60*time.Second, "duration to measure for, not counting --warmup and --cooldown, ex: 15s, 1m, 10h")
+	pflag.StringVar(&fChecksumResults, "checksum-results", "", "checksum the rows returned by each transaction and report the checksums per script, to compare results across databases; `mode` is ordered, or unordered to ignore row order")
+	pflag.Lookup("checksum-results").NoOptDefVal = string(neobench.ChecksumOrdered)
+	pflag.StringVar(&fTransactionMode, "transaction-mode", string(neobench.TransactionManaged), "how to run the statements of each script: `managed` transaction functions, retried by the driver on transient errors, explicit transactions with no retries, or autocommit, one transaction per statement")
+	pflag.StringArrayVar(&fErrorRules, "error-rule", nil, "group errors with messages matching a regex under your own label, ex: 'lock.*timed out=>lock timeout'; repeatable, first match wins")
+	pflag.StringSliceVar(&fRetriableCodes, "retriable-codes", nil, "error codes to retry transactions on, in place of the driver's transient errors, * matching anything, ex: Neo.TransientError.*,MyProc.Busy; include 'default' to extend the driver's set instead; errors on commit of managed transactions are still retried by the driver's own rules")
+	pflag.IntVar(&fMaxInFlight, "max-in-flight", 0, "cap on transactions running at once across all clients, below --clients since each client runs one at a time; when reached, clients wait for a slot, and the wait counts towards latency. 0 means no cap")
+	pflag.Int64Var(&fAbortAfterFailures, "abort-after-failures", 0, "stop the run early if this many transactions in a row fail, across all clients; 0 means never")
+	pflag.DurationVar(&fWarmup, "warmup", 0, "run the workload for this long before measuring, results during warmup are discarded, ex: 30s")
+	pflag.StringVar(&fBetweenPhasesCmd, "between-phases-cmd", "", "shell command to run after --warmup and before measuring, ex: to restart neo4j and measure with a cold cache; the run is aborted if it fails")
+	pflag.DurationVar(&fCooldown, "cooldown", 0, "keep running the workload for this long after measuring, results during cooldown are discarded, ex: 30s")
 	pflag.BoolVarP(&fLatencyMode, "latency", "l", false, "run in latency testing more rather than throughput mode")
 	pflag.Float64VarP(&fRate, "rate", "r", 1, "in latency mode (see -l) sets total transactions per second")
-	pflag.StringVarP(&fOutputFormat, "output", "o", "auto", "output format, `auto`, `interactive` or `csv`")
+	pflag.StringSliceVar(&fLatencyTargets, "latency-target", nil, "in latency mode, fail the run if any script's latency at a percentile is above its target, ex: p50=5ms,p99=50ms,p99.9=200ms")
+	pflag.StringVarP(&fOutputFormat, "output", "o", "auto", "output format, `auto`, `interactive`, `csv`, `ndjson`, `json` or `html`")
+	pflag.StringVar(&fSaveResult, "save-result", "", "also save the result to this file or s3:// or gs:// url, so it can be re-rendered later with neobench render")
+	pflag.StringSliceVar(&fCsvColumns, "csv-columns", nil, "in csv output, write only these latency columns, in this order, ex: db,script,rate,p99")
+	pflag.Float64SliceVar(&fJsonQuantiles, "json-quantiles", nil, "in json output, the latency percentiles to report, ex: 50,99,99.9,99.99; defaults to 50,75,90,95,99,99.9,99.99")
+	pflag.StringVar(&fLocale, "locale", "", "locale to format numbers in, in interactive output, ex: de_DE; taken from LC_ALL, LC_NUMERIC or LANG if not set, C for plain numbers")
+	pflag.BoolVar(&fCsvMetadata, "csv-metadata", false, "in csv output, start with # comment lines recording the scenario, start time, neobench version and target url")
+	pflag.StringVar(&fOutputFile, "output-file", "", "write results to this file rather than stdout, or upload them to an s3:// or gs:// url at the end of the run; gzip-compressed if the path ends in .gz")
+	pflag.BoolVar(&fCompress, "compress", false, "gzip-compress the --output-file regardless of its name")
+	pflag.DurationVar(&fFlushInterval, "flush-interval", 0, "flush results written to stdout or --output-file at most this often, ex: 1m; 0 flushes after every progress report, so consumers reading the output live see each line promptly")
+	pflag.BoolVar(&fReadOnly, "read-only", false, "refuse to run scripts that write, and run all transactions in read access mode; for benchmarking production replicas")
 
 	// Flags defining the workload to run
 	pflag.StringToStringVarP(&fVariables, "define", "D", nil, "defines variables for workload scripts and query parameters")
 	pflag.StringSliceVarP(&fBuiltinWorkloads, "builtin", "b", []string{}, "built-in workload to run 'tpcb-like' or 'ldbc-like', default is tpcb-like")
 	pflag.StringSliceVarP(&fWorkloadFiles, "file", "f", []string{}, "path to workload script file(s)")
 	pflag.StringArrayVarP(&fWorkloadScripts, "script", "S", []string{}, "script(s) to run, directly specified on the command line")
+	pflag.StringVar(&fRecordParams, "record-params", "", "write the queries and parameters of every transaction run, warmup included, to this file, one JSON object per line, to replay with --replay-params")
+	pflag.StringVar(&fReplayParams, "replay-params", "", "run the transactions recorded with --record-params, in order, rather than drawing scripts and parameters at random; the run ends early if they run out")
+	pflag.StringSliceVar(&fSchemaFiles, "schema-file", nil, "path to file(s) of schema statements, like CREATE INDEX, to run before --init and the workload, each statement in its own transaction")
 
 	// Less common command line vars
-	pflag.DurationVar(&fProgress, "progress", 10*time.Second, "interval to report progress, ex: 15s, 1m, 1h")
+	pflag.Var(&fProgress, "progress", "interval to report progress, ex: 15s, 1m, 1h, or every N transactions, ex: 10000tx")
 	pflag.BoolVar(&fNoCheckCertificates, "no-check-certificates", false, "disable TLS certificate validation, exposes your credentials to anyone on the network")
 	pflag.DurationVar(&fMaxConnLifetime, "max-conn-lifetime", 1*time.Hour, "when connections are older than this, they are ejected from the connection pool")
+	pflag.DurationVar(&fLivenessCheck, "connection-liveness-check", 0, "check that a client's connection is alive before reusing it if it has been idle for longer than this, ex: 30s; for workloads with long think times, 0 to disable")
 	pflag.BoolVar(&fDriverDebugLogging, "driver-debug-logging", false, "enable debug-level logging for the underlying neo4j driver")
 	pflag.StringVar(&fPrometheusAddr, "prometheus", "", "enable prometheus metrics at this host:port, ex: localhost:1234, :1234")
+	pflag.StringVar(&fServerMetricsUrl, "server-metrics-url", "", "scrape the Neo4j prometheus metrics endpoint at this url at each progress report, and report page cache hit ratio, GC pauses and heap use, ex: http://localhost:2004/metrics")
+	pflag.BoolVar(&fLatencyBreakdown, "latency-breakdown", false, "in latency mode, also report how much of the latency was spent in each phase of the transaction")
+	pflag.DurationVar(&fLatencyResolution, "latency-resolution", neobench.DefaultLatencyResolution, "resolution to record latencies at; use 1ns for very fast operations, where microseconds round away real differences")
+	pflag.Float64Var(&fLatencySampleRate, "latency-sample-rate", 1, "fraction of transactions, between 0 and 1, to record latencies for; all transactions still count towards rate and failures")
+	pflag.StringVar(&fRunId, "run-id", "", "identifies this run in the transaction metadata neobench attaches to each transaction, generated if not set")
+	pflag.BoolVar(&fProfileSlowest, "profile-slowest", false, "after the run, run the script with the highest mean latency once more with PROFILE, rolled back, and print its query plans")
+	pflag.BoolVar(&fIsolateScripts, "isolate-scripts", false, "give each script its own -c clients, connection pool and, in latency mode, its weighted share of --rate, rather than mixing scripts in one set of clients; scripts with weight 0 are not run")
+	pflag.BoolVar(&fSequential, "sequential", false, "run each script on its own, one after the other, each through the full --warmup, --duration and --cooldown, and report each separately")
+	pflag.StringVar(&fScenarioNote, "scenario-note", "", "free-text note appended to the scenario shown in all outputs and saved results, ex: \"after index rebuild\"")
+	pflag.IntVar(&fResultsBuffer, "results-buffer", 0, "size of the buffer workers hand their final results to the aggregator through; 0 means one slot per client")
+	pflag.BoolVarP(&fVerbose, "verbose", "v", false, "also report diagnostics about neobench itself, such as how often workers and the results aggregator blocked on each other")
+	pflag.BoolVar(&fVersion, "version", false, "print neobench, driver and go runtime versions and exit")
 }
 
 func main() {
@@ -72,28 +157,115 @@ func main() {
 
 Usage:
   neobench [OPTION]... [DBNAME]
+  neobench render --input FILE [--output FORMAT]
+  neobench watch --prometheus-url HOST:PORT
+  neobench suite [OPTION]... FILE...
 
 Options:
 `)
 		pflag.PrintDefaults()
 	}
-	pflag.Parse()
+	if len(os.Args) > 1 && os.Args[1] == "render" {
+		os.Exit(render(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "watch" {
+		os.Exit(watch(os.Args[2:]))
+	}
+	suiteMode := len(os.Args) > 1 && os.Args[1] == "suite"
+	if suiteMode {
+		parseSuiteArgs(os.Args[2:])
+	} else {
+		pflag.Parse()
+	}
+	if fVersion {
+		fmt.Print(describeVersion())
+		os.Exit(0)
+	}
 	if len(os.Args) == 1 {
 		pflag.Usage()
 		os.Exit(1)
 	}
 
+	if fLatencySampleRate <= 0 || fLatencySampleRate > 1 {
+		log.Fatalf("--latency-sample-rate must be greater than 0 and at most 1, got %f", fLatencySampleRate)
+	}
+
+	if fLatencyResolution < time.Nanosecond || fLatencyResolution > time.Millisecond {
+		log.Fatalf("--latency-resolution must be between 1ns and 1ms, got %s", fLatencyResolution)
+	}
+
+	for _, raw := range fErrorRules {
+		rule, err := neobench.ParseErrorRule(raw)
+		if err != nil {
+			log.Fatalf("invalid --error-rule: %s", err)
+		}
+		errorRules = append(errorRules, rule)
+	}
+
+	if len(fRetriableCodes) > 0 {
+		codes, err := neobench.ParseRetriableCodes(fRetriableCodes)
+		if err != nil {
+			log.Fatalf("invalid --retriable-codes: %s", err)
+		}
+		retriableCodes = codes
+	}
+
+	for _, raw := range fLatencyTargets {
+		target, err := neobench.ParseLatencyTarget(raw)
+		if err != nil {
+			log.Fatalf("invalid --latency-target: %s", err)
+		}
+		latencyTargets = append(latencyTargets, target)
+	}
+	if len(latencyTargets) > 0 && !fLatencyMode {
+		log.Fatalf("--latency-target needs --latency, latencies measured in throughput mode are not meaningful")
+	}
+
+	if fMaxInFlight < 0 || (fMaxInFlight > 0 && fMaxInFlight >= fClients) {
+		log.Fatalf("--max-in-flight must be below --clients, since each client has at most one transaction in flight, got %d with %d clients", fMaxInFlight, fClients)
+	}
+
+	if fResultsBuffer < 0 {
+		log.Fatalf("--results-buffer must be 0 or more, got %d", fResultsBuffer)
+	}
+
+	if fSequential && fIsolateScripts {
+		log.Fatalf("--sequential already runs each script on its own clients, so it can't be combined with --isolate-scripts")
+	}
+
+	if fSequential && fSaveResult != "" {
+		log.Fatalf("--save-result saves a single result, but --sequential produces one per script")
+	}
+
+	for _, destination := range []string{fOutputFile, fSaveResult} {
+		if err := neobench.ValidateDestination(destination); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if fSequential && fOutputFormat == "html" {
+		log.Fatalf("html output is a report of a single result, but --sequential produces one per script")
+	}
+
+	if fReplayParams != "" && (fIsolateScripts || fSequential) {
+		log.Fatalf("--replay-params runs the recorded transactions in one sequence, so it can't be combined with --isolate-scripts or --sequential")
+	}
+
+	if fReadOnly && len(fSchemaFiles) > 0 {
+		log.Fatalf("--schema-file changes the database schema, so it can't be combined with --read-only")
+	}
+
+	if fReadOnly && fInitMode {
+		log.Fatalf("--init populates the database, so it can't be combined with --read-only")
+	}
+
 	// If no workloads at all are specified, we run tpc-b
-	if len(fBuiltinWorkloads) == 0 && len(fWorkloadScripts) == 0 && len(fWorkloadFiles) == 0 {
+	if !suiteMode && len(fBuiltinWorkloads) == 0 && len(fWorkloadScripts) == 0 && len(fWorkloadFiles) == 0 {
 		fBuiltinWorkloads = []string{"tpcb-like"}
 	}
 
-	seed := time.Now().Unix()
-	scenario := describeScenario()
-
-	out, err := neobench.InitOutput(fOutputFormat, fPrometheusAddr)
-	if err != nil {
-		log.Fatal(err)
+	if fRunId == "" {
+		fRunId = generateRunId()
 	}
 
 	var encryptionMode neobench.EncryptionMode
@@ -108,22 +280,6 @@ Options:
 		log.Fatalf("Invalid encryption mode '%s', needs to be one of 'auto', 'true' or 'false'", fEncryptionMode)
 	}
 
-	dbName := ""
-	if pflag.NArg() > 0 {
-		dbName = pflag.Arg(0)
-	}
-
-	driver, err := neobench.NewDriver(fAddress, fUser, fPassword, encryptionMode, !fNoCheckCertificates, func(c *neo4j.Config) {
-		c.UserAgent = "neobench"
-		c.MaxConnectionLifetime = fMaxConnLifetime
-		if fDriverDebugLogging {
-			c.Log = neo4j.ConsoleLogger(neo4j.DEBUG)
-		}
-	})
-	if err != nil {
-		log.Fatal(err)
-	}
-
 	variables := make(map[string]interface{})
 	variables["scale"] = fScale
 	for k, v := range fVariables {
@@ -140,56 +296,323 @@ Options:
 		log.Fatalf("-D and --define values must be integers or floats, failing to parse '%s': %s", v, err)
 	}
 
-	wrk, err := createWorkload(driver, dbName, variables, seed)
+	seed := time.Now().Unix()
+	scenario := describeScenario() + describeScenarioNote(fScenarioNote)
+
+	// From here on, exit through exit(), so the output file and anything else opened is flushed and closed
+	outStream := io.Writer(os.Stdout)
+	if fOutputFile != "" {
+		outFile, err := neobench.CreateOutputFile(fOutputFile, fCompress)
+		if err != nil {
+			log.Fatal(err)
+		}
+		closeOnExit = append(closeOnExit, outFile)
+		outStream = outFile
+	}
+	bufferedOut := neobench.NewBufferedStream(outStream, fFlushInterval)
+	// Flushed before the output file is closed
+	closeOnExit = append([]io.Closer{bufferedOut}, closeOnExit...)
+
+	out, err := neobench.InitOutput(fOutputFormat, neobench.OutputOptions{
+		OutStream:         bufferedOut,
+		PrometheusAddress: fPrometheusAddr,
+		CsvMetadata:       fCsvMetadata,
+		CsvColumns:        fCsvColumns,
+		JsonQuantiles:     fJsonQuantiles,
+		Version:           version,
+		Locale:            fLocale,
+	})
 	if err != nil {
-		log.Fatalf("%+v", err)
+		log.Printf("%s", err)
+		exit(1)
+	}
+	if closer, ok := out.(io.Closer); ok {
+		// Writes results held back by outputs like json, before they are flushed
+		closeOnExit = append([]io.Closer{closer}, closeOnExit...)
+	}
+
+	dbName := ""
+	if suiteMode {
+		dbName = fSuiteDatabase
+	} else if pflag.NArg() > 0 {
+		dbName = pflag.Arg(0)
+	}
+
+	password, err := resolvePassword()
+	if err != nil {
+		out.Errorf("%s", err)
+		exit(1)
+	}
+
+	newDriver := func() (neo4j.Driver, error) {
+		return neobench.NewDriver(fAddress, fUser, password, encryptionMode, !fNoCheckCertificates, func(c *neo4j.Config) {
+			c.UserAgent = "neobench"
+			c.MaxConnectionLifetime = fMaxConnLifetime
+			if fDriverDebugLogging {
+				c.Log = neo4j.ConsoleLogger(neo4j.DEBUG)
+			}
+		})
+	}
+	driver, err := newDriver()
+	if err != nil {
+		out.Errorf("%s", neobench.DescribeConnectionError(fAddress, err))
+		exit(1)
+	}
+	if err := neobench.VerifyConnectivity(driver, fAddress); err != nil {
+		out.Errorf("%s", err)
+		exit(1)
+	}
+	if fServerMetricsUrl != "" {
+		if _, err := neobench.NewServerMetricsScraper(fServerMetricsUrl).Sample(); err != nil {
+			out.Errorf("%s; check that metrics.prometheus.enabled is set on the server", err)
+			exit(1)
+		}
+	}
+
+	// Before loading the workload, since preflight checks of scripts that use index hints need the indexes
+	for _, path := range fSchemaFiles {
+		if err := runSchemaFile(driver, dbName, variables, path, out); err != nil {
+			out.Errorf("%s", err)
+			exit(1)
+		}
+	}
+
+	if suiteMode {
+		exit(runSuite(driver, newDriver, dbName, variables, seed, out))
+	}
+
+	wrk, err := createWorkload(driver, dbName, variables, seed, fBuiltinWorkloads, fWorkloadFiles, fWorkloadScripts)
+	if err != nil {
+		out.Errorf("%s", err)
+		exit(1)
+	}
+	if fRecordParams != "" {
+		f, err := neobench.CreateDestination(fRecordParams)
+		if err != nil {
+			out.Errorf("%s", err)
+			exit(1)
+		}
+		wrk.RecordParams = neobench.NewParamsRecorder(f)
+		// Flushed before the file is closed
+		closeOnExit = append(closeOnExit, wrk.RecordParams, f)
+	}
+	if fReplayParams != "" {
+		f, err := os.Open(fReplayParams)
+		if err != nil {
+			out.Errorf("failed to open --replay-params file: %s", err)
+			exit(1)
+		}
+		closeOnExit = append(closeOnExit, f)
+		wrk.ReplayParams = neobench.NewParamsReplay(f)
 	}
 
 	if fInitMode {
 		err = initWorkload(fBuiltinWorkloads, dbName, fScale, seed, driver, out)
 		if err != nil {
-			log.Fatalf("%+v", err)
+			out.Errorf("%s", err)
+			exit(1)
 		}
 	}
 
 	if fDuration == 0 {
 		fmt.Printf("Duration (--duration) is 0, exiting without running any load\n")
-		os.Exit(0)
+		exit(0)
+	}
+
+	if fSequential {
+		exit(runSequentially(driver, dbName, scenario, wrk, out))
 	}
 
+	pools, err := planWorkerPools(driver, newDriver, wrk)
+	if err != nil {
+		out.Errorf("%s", err)
+		exit(1)
+	}
+	out.BenchmarkStart(dbName, fAddress, scenario)
+
 	if fLatencyMode {
-		result, err := runBenchmark(driver, fAddress, dbName, scenario, out, wrk, fDuration, fLatencyMode, fClients, fRate, fProgress)
+		result, err := runBenchmark(pools, dbName, scenario, out, fWarmup, fDuration, fCooldown, fLatencyMode, fProgress)
 		if err != nil {
 			out.Errorf(err.Error())
-			os.Exit(1)
+			exit(1)
 		}
 		out.ReportLatency(result)
-		if result.TotalFailed() == 0 {
-			os.Exit(0)
+		saveResult(result, fLatencyMode, out)
+		profileSlowest(driver, dbName, wrk, result, out)
+		if result.TotalFailed() == 0 && meetsLatencyTargets(result, out) {
+			exit(0)
 		} else {
-			os.Exit(1)
+			exit(1)
 		}
 	} else {
-		result, err := runBenchmark(driver, fAddress, dbName, scenario, out, wrk, fDuration, fLatencyMode, fClients, fRate, fProgress)
+		result, err := runBenchmark(pools, dbName, scenario, out, fWarmup, fDuration, fCooldown, fLatencyMode, fProgress)
 		if err != nil {
 			out.Errorf(err.Error())
-			os.Exit(1)
+			exit(1)
 		}
 		out.ReportThroughput(result)
+		saveResult(result, fLatencyMode, out)
+		profileSlowest(driver, dbName, wrk, result, out)
 		if result.TotalFailed() == 0 {
-			os.Exit(0)
+			exit(0)
 		} else {
-			os.Exit(1)
+			exit(1)
+		}
+	}
+}
+
+// Runs each script of the workload on its own, one after the other, reporting each as soon as it completes,
+// and returns the exit code. An interrupt stops the script running at the time and skips the rest. The output
+// is started once for all of them, so outputs with a header, like csv, write it once.
+func runSequentially(driver neo4j.Driver, dbName, scenario string, wrk neobench.Workload, out neobench.Output) int {
+	stopCh, stop := neobench.SetupSignalHandler()
+	defer stop()
+
+	out.BenchmarkStart(dbName, fAddress, scenario)
+
+	exitCode := 0
+	combined := neobench.NewResult(dbName, scenario)
+	for _, isolated := range wrk.Isolate() {
+		select {
+		case <-stopCh:
+			out.Errorf("interrupted, skipping the remaining scripts")
+			return 1
+		default:
+		}
+		pools := []workerPool{{driver: driver, workload: isolated, numClients: fClients, rate: fRate}}
+		result, err := runBenchmark(pools, dbName, scenario, out, fWarmup, fDuration, fCooldown, fLatencyMode, fProgress)
+		if err != nil {
+			out.Errorf(err.Error())
+			return 1
+		}
+		if fLatencyMode {
+			out.ReportLatency(result)
+		} else {
+			out.ReportThroughput(result)
+		}
+		if result.TotalFailed() > 0 || !meetsLatencyTargets(result, out) {
+			exitCode = 1
+		}
+		for name, script := range result.Scripts {
+			combined.Scripts[name] = script
+		}
+	}
+	profileSlowest(driver, dbName, wrk, combined, out)
+	return exitCode
+}
+
+// Checks the result against --latency-target, reporting each target that was missed
+func meetsLatencyTargets(result neobench.Result, out neobench.Output) bool {
+	misses := neobench.CheckLatencyTargets(result, latencyTargets)
+	for _, miss := range misses {
+		out.Errorf("latency target missed, %s", miss)
+	}
+	return len(misses) == 0
+}
+
+// Prints the query plans of the slowest script, if --profile-slowest is set. Failing to profile is reported,
+// but doesn't fail the run, since the benchmark itself is done by now.
+func profileSlowest(driver neo4j.Driver, dbName string, wrk neobench.Workload, result neobench.Result, out neobench.Output) {
+	if !fProfileSlowest {
+		return
+	}
+	slowest := result.Slowest()
+	if slowest == nil {
+		out.Errorf("--profile-slowest: no script completed a transaction, so there is nothing to profile")
+		return
+	}
+	plan, err := neobench.ProfileScript(driver, dbName, wrk, slowest.ScriptName)
+	if err != nil {
+		out.Errorf("--profile-slowest: %s", err)
+		return
+	}
+	neobench.ReportPlan(out, slowest.ScriptName, plan)
+}
+
+// Saves the result for `neobench render`, if --save-result is set
+func saveResult(result neobench.Result, latencyMode bool, out neobench.Output) {
+	writeSaveResult(out, func(w io.Writer) error {
+		return neobench.SaveResult(w, result, latencyMode)
+	})
+}
+
+// Saves the results of a suite for `neobench render`, if --save-result is set
+func saveSuite(suite neobench.SuiteResult, latencyMode bool, out neobench.Output) {
+	writeSaveResult(out, func(w io.Writer) error {
+		return neobench.SaveSuite(w, suite, latencyMode)
+	})
+}
+
+// Failing to save fails the run, after the output has been flushed and closed
+func writeSaveResult(out neobench.Output, save func(w io.Writer) error) {
+	if fSaveResult == "" {
+		return
+	}
+	f, err := neobench.CreateDestination(fSaveResult)
+	if err != nil {
+		out.Errorf("failed to save result: %s", err)
+		exit(1)
+	}
+	if err := save(f); err != nil {
+		_ = f.Close()
+		out.Errorf("%s", err)
+		exit(1)
+	}
+	if err := f.Close(); err != nil {
+		out.Errorf("failed to save result: %s", err)
+		exit(1)
+	}
+}
+
+// Used when there is no password given, and no one at a terminal to ask for one; the flag itself defaults to
+// empty, so --help doesn't suggest the password is always neo4j
+const defaultPassword = "neo4j"
+
+// The password to use; --password if given, otherwise $NEO4J_PASSWORD, otherwise we ask for it if there is
+// someone at a terminal to ask, and fall back to defaultPassword if not
+func resolvePassword() (string, error) {
+	if pflag.CommandLine.Changed("password") {
+		return fPassword, nil
+	}
+	if password, found := os.LookupEnv("NEO4J_PASSWORD"); found {
+		return password, nil
+	}
+	stdin := int(os.Stdin.Fd())
+	if !term.IsTerminal(stdin) {
+		return defaultPassword, nil
+	}
+	fmt.Fprintf(os.Stderr, "Password for %s at %s: ", fUser, neobench.RedactUrl(fAddress))
+	password, err := term.ReadPassword(stdin)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to read password")
+	}
+	return string(password), nil
+}
+
+// Things that need closing before we exit, like compressed output files that are truncated unless closed
+var closeOnExit []io.Closer
+
+func exit(code int) {
+	for _, c := range closeOnExit {
+		if err := c.Close(); err != nil {
+			log.Printf("%s", err)
+			code = 1
 		}
 	}
+	os.Exit(code)
 }
 
-func createWorkload(driver neo4j.Driver, dbName string, variables map[string]interface{}, seed int64) (neobench.Workload, error) {
+func createWorkload(driver neo4j.Driver, dbName string, variables map[string]interface{}, seed int64,
+	builtinWorkloads, workloadFiles, workloadScripts []string) (neobench.Workload, error) {
 	var err error
 	scripts := make([]neobench.Script, 0)
 	csvLoader := neobench.NewCsvLoader()
-	for _, rawPath := range fBuiltinWorkloads {
-		path, weight := splitScriptAndWeight(rawPath)
+	for _, rawPath := range builtinWorkloads {
+		path, weight, err := splitScriptAndWeight(rawPath)
+		if err != nil {
+			return neobench.Workload{}, err
+		}
 		builtinScripts, err := loadBuiltinWorkload(path, weight)
 		if err != nil {
 			return neobench.Workload{}, errors.Wrapf(err, "failed to load script '%s'", path)
@@ -197,8 +620,11 @@ func createWorkload(driver neo4j.Driver, dbName string, variables map[string]int
 		scripts = append(scripts, builtinScripts...)
 	}
 
-	for _, rawPath := range fWorkloadFiles {
-		path, weight := splitScriptAndWeight(rawPath)
+	for _, rawPath := range workloadFiles {
+		path, weight, err := splitScriptAndWeight(rawPath)
+		if err != nil {
+			return neobench.Workload{}, err
+		}
 		script, err := loadScriptFile(driver, dbName, variables, path, weight, csvLoader)
 		if err != nil {
 			return neobench.Workload{}, errors.Wrapf(err, "failed to load script '%s'", path)
@@ -206,7 +632,7 @@ func createWorkload(driver neo4j.Driver, dbName string, variables map[string]int
 		scripts = append(scripts, script)
 	}
 
-	for i, scriptContent := range fWorkloadScripts {
+	for i, scriptContent := range workloadScripts {
 		script, err := loadScript(driver, dbName, variables, fmt.Sprintf("-S #%d", i), scriptContent, 1.0, csvLoader)
 		if err != nil {
 			return neobench.Workload{}, errors.Wrapf(err, "failed to parse script '%s'", scriptContent)
@@ -214,27 +640,66 @@ func createWorkload(driver neo4j.Driver, dbName string, variables map[string]int
 		scripts = append(scripts, script)
 	}
 
+	if fReadOnly {
+		for i := range scripts {
+			if err := neobench.ValidateReadOnly(scripts[i]); err != nil {
+				return neobench.Workload{}, errors.Wrap(err, "--read-only is set")
+			}
+			scripts[i].Readonly = true
+		}
+	}
+
+	checksumMode, err := neobench.ParseChecksumMode(fChecksumResults)
+	if err != nil {
+		return neobench.Workload{}, errors.Wrap(err, "invalid --checksum-results")
+	}
+
+	transactionMode, err := neobench.ParseTransactionMode(fTransactionMode)
+	if err != nil {
+		return neobench.Workload{}, errors.Wrap(err, "invalid --transaction-mode")
+	}
+
 	return neobench.Workload{
-		Variables: variables,
-		Scripts:   neobench.NewScripts(scripts...),
-		Rand:      rand.New(rand.NewSource(seed)),
-		CsvLoader: csvLoader,
-	}, err
+		Variables:       variables,
+		Readonly:        fReadOnly,
+		ChecksumResults: checksumMode,
+		TransactionMode: transactionMode,
+		Scripts:         neobench.NewScripts(scripts...),
+		Rand:            rand.New(rand.NewSource(seed)),
+		CsvLoader:       csvLoader,
+		Sequences:       neobench.NewSequences(),
+	}, nil
+}
+
+func runSchemaFile(driver neo4j.Driver, dbName string, vars map[string]interface{}, path string, out neobench.Output) error {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read schema file at %s: %s", path, err)
+	}
+	expanded, err := neobench.ExpandEnv(string(content), os.LookupEnv)
+	if err != nil {
+		return err
+	}
+	script, err := neobench.Parse(path, expanded, 1)
+	if err != nil {
+		return err
+	}
+	return neobench.RunSchemaScript(driver, dbName, script, vars, out)
 }
 
 // Splits command-line specified scripts-with-weight into script and weight
 //   -f my.script@100 becomes "myscript", 100.0
 //   -b tpcb-like@10 becomes "tpcb-like", 10.0
-func splitScriptAndWeight(raw string) (string, float64) {
+func splitScriptAndWeight(raw string) (string, float64, error) {
 	parts := strings.Split(raw, "@")
 	if len(parts) < 2 {
-		return raw, 1.0
+		return raw, 1.0, nil
 	}
 	weight, err := strconv.ParseFloat(parts[1], 64)
 	if err != nil {
-		log.Fatalf("Failed to parse weight; value after @ symbol for workload weight must be a number: %s", raw)
+		return "", 0, fmt.Errorf("failed to parse weight; value after @ symbol for workload weight must be a number: %s", raw)
 	}
-	return parts[0], weight
+	return parts[0], weight, nil
 }
 
 func loadScriptFile(driver neo4j.Driver, dbName string, vars map[string]interface{}, path string, weight float64,
@@ -249,12 +714,20 @@ func loadScriptFile(driver neo4j.Driver, dbName string, vars map[string]interfac
 
 func loadScript(driver neo4j.Driver, dbName string, vars map[string]interface{}, path, scriptContent string, weight float64,
 	csvLoader *neobench.CsvLoader) (neobench.Script, error) {
+	scriptContent, err := neobench.ExpandEnv(scriptContent, os.LookupEnv)
+	if err != nil {
+		return neobench.Script{}, err
+	}
 	script, err := neobench.Parse(path, scriptContent, weight)
 	if err != nil {
 		return neobench.Script{}, err
 	}
 
 	readonly, err := neobench.WorkloadPreflight(driver, dbName, script, vars, csvLoader)
+	if err == nil && fReadOnly && !readonly {
+		// Catches writes we can't see in the script text, like procedures that write
+		err = fmt.Errorf("--read-only is set, but the database reports script '%s' may write", path)
+	}
 	script.Readonly = readonly
 	return script, err
 }
@@ -320,6 +793,27 @@ func loadBuiltinWorkload(path string, weight float64) ([]neobench.Script, error)
 	return []neobench.Script{}, fmt.Errorf("unknown built-in workload: %s, supported built-in workloads are 'tpcb-like', 'match-only' and 'ldbc-like'", path)
 }
 
+// Describes the neobench build, the neo4j driver it was built with and the go runtime; meant to be pasted
+// into bug reports
+func describeVersion() string {
+	driverVersion := "unknown"
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, dep := range info.Deps {
+			if dep.Path == "github.com/neo4j/neo4j-go-driver/v4" {
+				driverVersion = dep.Version
+				if dep.Replace != nil {
+					driverVersion = dep.Replace.Version
+				}
+			}
+		}
+	}
+	out := strings.Builder{}
+	out.WriteString(fmt.Sprintf("neobench %s\n", version))
+	out.WriteString(fmt.Sprintf("neo4j-go-driver %s (%s)\n", driverVersion, neo4j.UserAgent))
+	out.WriteString(fmt.Sprintf("%s %s/%s\n", runtime.Version(), runtime.GOOS, runtime.GOARCH))
+	return out.String()
+}
+
 func describeScenario() string {
 	out := strings.Builder{}
 	for _, path := range fBuiltinWorkloads {
@@ -334,69 +828,410 @@ func describeScenario() string {
 	out.WriteString(fmt.Sprintf(" -c %d", fClients))
 	out.WriteString(fmt.Sprintf(" -s %d", fScale))
 	out.WriteString(fmt.Sprintf(" -d %s", fDuration))
+	if fChecksumResults != "" {
+		out.WriteString(fmt.Sprintf(" --checksum-results=%s", fChecksumResults))
+	}
+	for _, rule := range fErrorRules {
+		out.WriteString(fmt.Sprintf(" --error-rule %s", shellQuote(rule)))
+	}
+	if fIsolateScripts {
+		out.WriteString(" --isolate-scripts")
+	}
+	if fSequential {
+		out.WriteString(" --sequential")
+	}
+	if fMaxInFlight > 0 {
+		out.WriteString(fmt.Sprintf(" --max-in-flight %d", fMaxInFlight))
+	}
+	if fAbortAfterFailures > 0 {
+		out.WriteString(fmt.Sprintf(" --abort-after-failures %d", fAbortAfterFailures))
+	}
+	if fWarmup > 0 {
+		out.WriteString(fmt.Sprintf(" --warmup %s", fWarmup))
+	}
+	if fBetweenPhasesCmd != "" {
+		out.WriteString(fmt.Sprintf(" --between-phases-cmd %s", shellQuote(fBetweenPhasesCmd)))
+	}
+	if fCooldown > 0 {
+		out.WriteString(fmt.Sprintf(" --cooldown %s", fCooldown))
+	}
 	out.WriteString(fmt.Sprintf(" -e %s", fEncryptionMode))
+	out.WriteString(fmt.Sprintf(" --transaction-mode %s", fTransactionMode))
+	if len(fRetriableCodes) > 0 {
+		out.WriteString(fmt.Sprintf(" --retriable-codes %s", strings.Join(fRetriableCodes, ",")))
+	}
 	if fLatencyMode {
 		out.WriteString(fmt.Sprintf(" -l -r %.3f", fRate))
 	}
+	for _, target := range latencyTargets {
+		out.WriteString(fmt.Sprintf(" --latency-target %s", target))
+	}
+	if fReadOnly {
+		out.WriteString(" --read-only")
+	}
+	if fLatencySampleRate < 1 {
+		out.WriteString(fmt.Sprintf(" --latency-sample-rate %.3f", fLatencySampleRate))
+	}
+	if fLatencyResolution != neobench.DefaultLatencyResolution {
+		out.WriteString(fmt.Sprintf(" --latency-resolution %s", fLatencyResolution))
+	}
+	for _, path := range fSchemaFiles {
+		out.WriteString(fmt.Sprintf(" --schema-file %s", path))
+	}
+	if fReplayParams != "" {
+		out.WriteString(fmt.Sprintf(" --replay-params %s", fReplayParams))
+	}
 	if fInitMode {
 		out.WriteString(" -i")
 	}
+	// Generated run ids differ every run, which would keep identical runs from being matched by their scenario
+	if pflag.Lookup("run-id").Changed {
+		out.WriteString(fmt.Sprintf(" --run-id %s", fRunId))
+	}
 	return out.String()
 }
 
-func runBenchmark(driver neo4j.Driver, url, databaseName, scenario string, out neobench.Output, wrk neobench.Workload,
-	runtime time.Duration, latencyMode bool, numClients int, rate float64, progressInterval time.Duration) (neobench.Result, error) {
+// Quotes s as a single shell word, so the scenario can be pasted into a shell whatever s contains
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// The note goes after a shell comment marker, so the scenario can still be pasted after `neobench` as-is
+func describeScenarioNote(note string) string {
+	note = strings.Join(strings.Fields(note), " ")
+	if note == "" {
+		return ""
+	}
+	return fmt.Sprintf(" # %s", note)
+}
+
+func generateRunId() string {
+	b := make([]byte, 4)
+	if _, err := crand.Read(b); err != nil {
+		log.Fatalf("failed to generate run id, please specify one with --run-id: %s", err)
+	}
+	return fmt.Sprintf("%s-%s", time.Now().UTC().Format("20060102T150405"), hex.EncodeToString(b))
+}
+
+// A set of clients running a workload through one driver, and so one connection pool, at a shared total rate
+type workerPool struct {
+	driver     neo4j.Driver
+	workload   neobench.Workload
+	numClients int
+	rate       float64
+}
+
+// Normally all clients share one pool running the full script mix; with --isolate-scripts, each script gets
+// its own pool, with its own driver, so a slow script can't hold up the clients or connections of the others
+func planWorkerPools(driver neo4j.Driver, newDriver func() (neo4j.Driver, error), wrk neobench.Workload) ([]workerPool, error) {
+	if !fIsolateScripts {
+		return []workerPool{{driver: driver, workload: wrk, numClients: fClients, rate: fRate}}, nil
+	}
+	totalWeight := wrk.Scripts.TotalWeight()
+	pools := make([]workerPool, 0)
+	// The first pool with clients gets the driver we were given, the others one of their own
+	driverTaken := false
+	for _, isolated := range wrk.Isolate() {
+		// Never chosen when mixed with the others, so not run on their own either; in latency mode a rate of 0
+		// would mean no pacing at all, rather than no transactions. A pool without clients gets it reported as
+		// not executed.
+		if isolated.Scripts.TotalWeight() == 0 {
+			pools = append(pools, workerPool{driver: driver, workload: isolated})
+			continue
+		}
+		poolDriver := driver
+		if driverTaken {
+			var err error
+			if poolDriver, err = newDriver(); err != nil {
+				return nil, neobench.DescribeConnectionError(fAddress, err)
+			}
+			closeOnExit = append(closeOnExit, poolDriver)
+		}
+		driverTaken = true
+		pools = append(pools, workerPool{
+			driver:     poolDriver,
+			workload:   isolated,
+			numClients: fClients,
+			rate:       fRate * isolated.Scripts.TotalWeight() / totalWeight,
+		})
+	}
+	if !driverTaken {
+		return nil, errors.New("--isolate-scripts needs at least one script with a weight above 0")
+	}
+	return pools, nil
+}
+
+// Runs the workload through warmup, measurement and cooldown; only transactions that complete during the
+// measurement window, which is `runtime` long, are included in the returned result.
+func runBenchmark(pools []workerPool, databaseName, scenario string, out neobench.Output,
+	warmup, runtime, cooldown time.Duration, latencyMode bool, progress neobench.ProgressTrigger) (neobench.Result, error) {
 	stopCh, stop := neobench.SetupSignalHandler()
 	defer stop()
 
-	ratePerWorkerDuration := time.Duration(0)
-	if latencyMode {
-		ratePerWorkerDuration = neobench.TotalRatePerSecondToDurationPerClient(numClients, rate)
+	numClients := 0
+	for _, pool := range pools {
+		numClients += pool.numClients
 	}
 
-	out.BenchmarkStart(databaseName, url, scenario)
+	var failures *neobench.FailureStreak
+	if fAbortAfterFailures > 0 {
+		failures = neobench.NewFailureStreak(fAbortAfterFailures)
+		go func() {
+			select {
+			case <-failures.Tripped():
+				out.Errorf("aborting run, %s", failures.Reason())
+				stop()
+			case <-stopCh:
+			}
+		}()
+	}
 
-	resultChan := make(chan neobench.WorkerResult, numClients)
-	resultRecorders := make([]*neobench.ResultRecorder, 0)
-	var wg sync.WaitGroup
-	for i := 0; i < numClients; i++ {
-		wg.Add(1)
-		recorder := neobench.NewResultRecorder(int64(i))
-		resultRecorders = append(resultRecorders, recorder)
-		worker := neobench.NewWorker(driver, int64(i))
-		workerId := i
-		clientWork := wrk.NewClient()
+	// All pools share the workload's replay, if any
+	if replay := pools[0].workload.ReplayParams; replay != nil {
 		go func() {
-			defer wg.Done()
-			result := worker.RunBenchmark(clientWork, databaseName, ratePerWorkerDuration, 0, stopCh, recorder)
-			resultChan <- result
-			if result.Error != nil {
-				out.Errorf("worker %d crashed: %s", workerId, result.Error)
+			select {
+			case <-replay.Exhausted():
+				out.Errorf("all transactions in --replay-params have been run, ending the run early")
 				stop()
+			case <-stopCh:
 			}
 		}()
 	}
 
+	var inFlight *neobench.InFlightLimit
+	if fMaxInFlight > 0 {
+		inFlight = neobench.NewInFlightLimit(fMaxInFlight)
+	}
+
+	// Workers start counting transactions as they start, so the window starts before any of them do
+	measurementStart := time.Now()
+	resultsBuffer := fResultsBuffer
+	if resultsBuffer == 0 {
+		resultsBuffer = numClients
+	}
+	resultChan := make(chan neobench.WorkerResult, resultsBuffer)
+	// Times a worker found the results buffer full and had to wait for the aggregator, see --verbose
+	var sendsBlocked int64
+	resultRecorders := make([]*neobench.ResultRecorder, 0)
+	var wg sync.WaitGroup
+	scriptNames := make([]string, 0)
+	for _, pool := range pools {
+		wrk := pool.workload
+		scriptNames = append(scriptNames, wrk.Scripts.Names()...)
+		ratePerWorkerDuration := time.Duration(0)
+		if latencyMode && pool.numClients > 0 {
+			ratePerWorkerDuration = neobench.TotalRatePerSecondToDurationPerClient(pool.numClients, pool.rate)
+		}
+		for i := 0; i < pool.numClients; i++ {
+			wg.Add(1)
+			workerId := len(resultRecorders)
+			// Not drawn from the workload's Rand, so sampling doesn't change the transactions a given seed produces
+			var sampling *rand.Rand
+			if fLatencySampleRate < 1 {
+				sampling = rand.New(rand.NewSource(time.Now().UnixNano() + int64(workerId)))
+			}
+			// The breakdown only means something next to latencies; in throughput mode it would just be overhead
+			recorder := neobench.NewResultRecorder(int64(workerId), fLatencySampleRate, sampling, fLatencyBreakdown && fLatencyMode,
+				fLatencyResolution)
+			resultRecorders = append(resultRecorders, recorder)
+			worker := neobench.NewWorker(pool.driver, int64(workerId), fRunId, failures, inFlight, errorRules, retriableCodes, fLivenessCheck)
+			clientWork := wrk.NewClient()
+			go func() {
+				defer wg.Done()
+				result := worker.RunBenchmark(clientWork, databaseName, ratePerWorkerDuration, 0, stopCh, recorder)
+				select {
+				case resultChan <- result:
+				default:
+					atomic.AddInt64(&sendsBlocked, 1)
+					resultChan <- result
+				}
+				if result.Error != nil {
+					out.Errorf("worker %d crashed: %s", workerId, result.Error)
+					stop()
+				}
+			}()
+		}
+	}
+
+	if warmup > 0 {
+		awaitUnmeasuredPhase(stopCh, out, "warmup", warmup)
+	}
+	if fBetweenPhasesCmd != "" {
+		// Restarting the database, the typical command, fails every transaction until it is back up
+		if failures != nil {
+			failures.Suspend()
+		}
+		err := runBetweenPhasesCommand(fBetweenPhasesCmd, stopCh, out)
+		if failures != nil {
+			failures.Resume()
+		}
+		if err != nil {
+			stop()
+			for i := 0; i < numClients; i++ {
+				<-resultChan
+			}
+			wg.Wait()
+			return neobench.NewResult(databaseName, scenario), err
+		}
+	}
+	if warmup > 0 || fBetweenPhasesCmd != "" {
+		now := time.Now()
+		for _, r := range resultRecorders {
+			r.Reset(now)
+		}
+		measurementStart = now
+	}
+
+	var serverMetrics *neobench.ServerMetricsScraper
+	if fServerMetricsUrl != "" {
+		serverMetrics = neobench.NewServerMetricsScraper(fServerMetricsUrl)
+		sampleServerMetrics(serverMetrics, out)
+	}
+
+	// In latency mode, check whether the clients can keep up with the rate at all, as soon as there is something
+	// to go on; the first checkpoint, or the whole measurement if it ends before there is one
+	pacingChecked := !latencyMode
+	checkPacing := func(r neobench.Result) {
+		pacingChecked = true
+		for _, pool := range pools {
+			if warning, ok := neobench.DiagnosePacing(r, pool.workload.Scripts.Names(), pool.numClients, pool.rate); ok {
+				out.Errorf("warning: %s", warning)
+			}
+		}
+	}
+
 	deadline := time.Now().Add(runtime)
-	awaitCompletion(stopCh, deadline, out, databaseName, scenario, progressInterval, resultRecorders)
+	intervalRates := awaitCompletion(stopCh, deadline, out, databaseName, scenario, progress, resultRecorders, serverMetrics, checkPacing)
+
+	// This is the end of the measurement window; take the results now, anything recorded after this is discarded
+	measured := make([]neobench.WorkerResult, 0, numClients)
+	measurementEnd := time.Now()
+	for _, r := range resultRecorders {
+		measured = append(measured, r.Complete(measurementEnd))
+	}
+	if serverMetrics != nil {
+		sampleServerMetrics(serverMetrics, out)
+	}
+
+	if cooldown > 0 {
+		awaitUnmeasuredPhase(stopCh, out, "cooldown", cooldown)
+	}
 	stop()
+
+	// Collected before waiting for the workers, since the buffer may be smaller than the number of clients
+	result, err := collectResults(databaseName, scenario, out, numClients, resultChan, measured)
 	wg.Wait()
+	if fVerbose {
+		reportContention(resultRecorders, atomic.LoadInt64(&sendsBlocked))
+	}
+	if err != nil {
+		return result, err
+	}
+	result.IncludeScripts(scriptNames, fLatencyResolution)
+	result.ReconcileRates(measurementEnd.Sub(measurementStart))
+	if serverMetrics != nil {
+		result.ServerMetrics = serverMetrics.Samples()
+	}
+	result.IntervalRates = intervalRates
+	if !pacingChecked {
+		checkPacing(result)
+	}
+	return result, nil
+}
 
-	return collectResults(databaseName, scenario, out, numClients, resultChan)
+// Takes a sample of the server metrics, returning it as the samples for a progress checkpoint. A failed scrape
+// is reported but does not stop the run; the report is then just based on fewer samples.
+func sampleServerMetrics(scraper *neobench.ServerMetricsScraper, out neobench.Output) []neobench.ServerMetrics {
+	sample, err := scraper.Sample()
+	if err != nil {
+		out.Errorf("%s", err)
+		return nil
+	}
+	return []neobench.ServerMetrics{sample}
 }
 
-func collectResults(databaseName, scenario string, out neobench.Output, concurrency int, resultChan chan neobench.WorkerResult) (neobench.Result, error) {
-	// Collect results
-	results := make([]neobench.WorkerResult, 0, concurrency)
-	for i := 0; i < concurrency; i++ {
-		results = append(results, <-resultChan)
+// Written straight to stderr rather than through the output, since it is about neobench itself, not the workload
+func reportContention(recorders []*neobench.ResultRecorder, sendsBlocked int64) {
+	var recordBlocked, readBlocked int64
+	for _, r := range recorders {
+		record, read := r.Contention()
+		recordBlocked += record
+		readBlocked += read
 	}
+	fmt.Fprintf(os.Stderr, "Results aggregation: workers waited for the aggregator %d times while recording transactions "+
+		"and %d times handing over final results; the aggregator waited for workers %d times\n",
+		recordBlocked, sendsBlocked, readBlocked)
+}
 
-	total := neobench.NewResult(databaseName, scenario)
-	// Process results into one histogram and check for errors
-	for _, res := range results {
+// Runs the --between-phases-cmd shell command, with its output going to stderr, while clients keep running the
+// workload; what they record until the command completes is discarded with the warmup, and their failures don't
+// count towards --abort-after-failures. An interrupt kills it.
+func runBetweenPhasesCommand(command string, stopCh chan struct{}, out neobench.Output) error {
+	out.ReportInitProgress(neobench.ProgressReport{Section: "between phases", Step: fmt.Sprintf("running %s", command)})
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Stdout, cmd.Stderr = os.Stderr, os.Stderr
+	if err := cmd.Start(); err != nil {
+		return errors.Wrap(err, "failed to start --between-phases-cmd")
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			return errors.Wrapf(err, "--between-phases-cmd failed, aborting the run")
+		}
+	case <-stopCh:
+		_ = cmd.Process.Kill()
+		<-done
+		return nil
+	}
+	out.ReportInitProgress(neobench.ProgressReport{Section: "between phases", Step: "exited with status 0", Completeness: 1})
+	return nil
+}
+
+// Keeps the workload running for the given duration, outside of the measurement window; eg. warmup or cooldown
+func awaitUnmeasuredPhase(stopCh chan struct{}, out neobench.Output, phase string, duration time.Duration) {
+	start := time.Now()
+	deadline := start.Add(duration)
+	for {
+		out.ReportInitProgress(neobench.ProgressReport{
+			Section:      phase,
+			Step:         "running, results discarded",
+			Completeness: time.Since(start).Seconds() / duration.Seconds(),
+		})
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return
+		}
+		if remaining > 100*time.Millisecond {
+			remaining = 100 * time.Millisecond
+		}
+		select {
+		case <-stopCh:
+			return
+		case <-time.After(remaining):
+		}
+	}
+}
+
+// Combines the results measured from each worker, excluding workers that crashed
+func collectResults(databaseName, scenario string, out neobench.Output, concurrency int, resultChan chan neobench.WorkerResult,
+	measured []neobench.WorkerResult) (neobench.Result, error) {
+	crashed := make(map[int64]bool)
+	for i := 0; i < concurrency; i++ {
+		res := <-resultChan
 		if res.Error != nil {
 			out.Errorf("Worker failed: %v", res.Error)
+			crashed[res.WorkerId] = true
+		}
+	}
+
+	total := neobench.NewResult(databaseName, scenario)
+	// Process results into one histogram
+	for _, res := range measured {
+		if crashed[res.WorkerId] {
 			continue
 		}
 		total.Add(res)
@@ -420,9 +1255,12 @@ func initWorkload(paths []string, dbName string, scale, seed int64, driver neo4j
 	return nil
 }
 
-func awaitCompletion(stopCh chan struct{}, deadline time.Time, out neobench.Output, databaseName, scenario string, progressInterval time.Duration, recorders []*neobench.ResultRecorder) {
-	nextProgressReport := time.Now().Add(progressInterval)
+func awaitCompletion(stopCh chan struct{}, deadline time.Time, out neobench.Output, databaseName, scenario string, progress neobench.ProgressTrigger,
+	recorders []*neobench.ResultRecorder, serverMetrics *neobench.ServerMetricsScraper, onFirstCheckpoint func(neobench.Result)) (intervalRates []float64) {
+	nextProgressReport := time.Now().Add(progress.Interval)
+	nextProgressCount := progress.Transactions
 	originalDelta := deadline.Sub(time.Now()).Seconds()
+	lastCheckpoint := time.Now()
 	for {
 		select {
 		case <-stopCh:
@@ -437,16 +1275,44 @@ func awaitCompletion(stopCh chan struct{}, deadline time.Time, out neobench.Outp
 			break
 		}
 
-		if now.After(nextProgressReport) {
-			nextProgressReport = nextProgressReport.Add(progressInterval)
+		reportDue := false
+		if progress.Transactions > 0 {
+			completed := int64(0)
+			for _, r := range recorders {
+				completed += r.Completed()
+			}
+			if completed >= nextProgressCount {
+				reportDue = true
+				// Skip ahead rather than reporting once per missed threshold if we're polling slower than
+				// transactions are completing
+				nextProgressCount += progress.Transactions * ((completed-nextProgressCount)/progress.Transactions + 1)
+			}
+		} else if now.After(nextProgressReport) {
+			reportDue = true
+			nextProgressReport = nextProgressReport.Add(progress.Interval)
+		}
+
+		if reportDue {
 			checkpoint := neobench.NewResult(databaseName, scenario)
+			checkpointTime := time.Now()
 			for _, r := range recorders {
-				checkpoint.Add(r.ProgressReport(time.Now()))
+				checkpoint.Add(r.ProgressReport(checkpointTime))
+			}
+			checkpoint.ReconcileRates(checkpointTime.Sub(lastCheckpoint))
+			lastCheckpoint = checkpointTime
+			intervalRates = append(intervalRates, checkpoint.TotalRate())
+			if serverMetrics != nil {
+				checkpoint.ServerMetrics = sampleServerMetrics(serverMetrics, out)
 			}
 
 			completeness := 1 - delta.Seconds()/originalDelta
 			out.ReportWorkloadProgress(completeness, checkpoint)
+			if onFirstCheckpoint != nil {
+				onFirstCheckpoint(checkpoint)
+				onFirstCheckpoint = nil
+			}
 		}
 		time.Sleep(time.Millisecond * 100)
 	}
+	return
 }
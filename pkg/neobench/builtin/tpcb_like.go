@@ -37,8 +37,8 @@ func InitTPCBLike(scale int64, dbName string, driver neo4j.Driver, out neobench.
 	defer session.Close()
 
 	out.ReportInitProgress(neobench.ProgressReport{
-		Section:      "init",
-		Step:         "create schema",
+		Section:      "schema",
+		Step:         "create constraints",
 		Completeness: 0,
 	})
 
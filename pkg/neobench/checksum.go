@@ -0,0 +1,179 @@
+package neobench
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
+	"github.com/pkg/errors"
+	"hash"
+	"io"
+	"sort"
+	"strings"
+)
+
+// How to checksum the rows returned by each transaction, see --checksum-results
+type ChecksumMode string
+
+const (
+	ChecksumOff ChecksumMode = ""
+	// Rows are hashed in the order they were returned; use when queries have an ORDER BY
+	ChecksumOrdered ChecksumMode = "ordered"
+	// Row order doesn't affect the checksum
+	ChecksumUnordered ChecksumMode = "unordered"
+)
+
+func ParseChecksumMode(raw string) (ChecksumMode, error) {
+	switch mode := ChecksumMode(raw); mode {
+	case ChecksumOff, ChecksumOrdered, ChecksumUnordered:
+		return mode, nil
+	}
+	return ChecksumOff, errors.Errorf("checksum mode must be 'ordered' or 'unordered', got '%s'", raw)
+}
+
+// We track how many transactions returned each distinct checksum, up to this many distinct ones; scripts
+// with random parameters produce a new checksum for nearly every transaction, and we don't want to keep them all
+const maxTrackedChecksums = 100
+
+// Checksums beyond maxTrackedChecksums are counted under this key
+const untrackedChecksums = "other"
+
+// Computes a checksum of all the rows returned by one unit of work. Internal node and relationship ids are
+// left out, so the same data in two different databases gives the same checksum.
+type resultChecksum struct {
+	mode      ChecksumMode
+	statement int
+	ordered   hash.Hash
+	rows      []string
+}
+
+func newResultChecksum(mode ChecksumMode) *resultChecksum {
+	return &resultChecksum{mode: mode, ordered: sha256.New()}
+}
+
+// Checksums one row returned by the next statement; rows only count once the statement has succeeded and they
+// are given to addStatement, so an autocommit statement that fails half way through and is retried counts once
+func (c *resultChecksum) rowSum(record *neo4j.Record) []byte {
+	row := sha256.New()
+	_, _ = fmt.Fprintf(row, "%d:", c.statement+1)
+	for i, key := range record.Keys {
+		_, _ = fmt.Fprintf(row, "%q=", key)
+		writeChecksumValue(row, record.Values[i])
+		_, _ = io.WriteString(row, ";")
+	}
+	return row.Sum(nil)
+}
+
+func (c *resultChecksum) addStatement(rows [][]byte) {
+	c.statement++
+	for _, row := range rows {
+		if c.mode == ChecksumUnordered {
+			c.rows = append(c.rows, string(row))
+		} else {
+			_, _ = c.ordered.Write(row)
+		}
+	}
+}
+
+func (c *resultChecksum) sum() string {
+	if c.mode == ChecksumUnordered {
+		sort.Strings(c.rows)
+		for _, row := range c.rows {
+			_, _ = io.WriteString(c.ordered, row)
+		}
+	}
+	return hex.EncodeToString(c.ordered.Sum(nil))[:16]
+}
+
+func writeChecksumValue(w io.Writer, v interface{}) {
+	switch v := v.(type) {
+	case neo4j.Node:
+		labels := append([]string(nil), v.Labels...)
+		sort.Strings(labels)
+		_, _ = fmt.Fprintf(w, "node(%s ", strings.Join(labels, ":"))
+		writeChecksumValue(w, v.Props)
+		_, _ = io.WriteString(w, ")")
+	case neo4j.Relationship:
+		_, _ = fmt.Fprintf(w, "rel(%s ", v.Type)
+		writeChecksumValue(w, v.Props)
+		_, _ = io.WriteString(w, ")")
+	case neo4j.Path:
+		_, _ = io.WriteString(w, "path(")
+		for _, n := range v.Nodes {
+			writeChecksumValue(w, n)
+		}
+		for _, r := range v.Relationships {
+			writeChecksumValue(w, r)
+		}
+		_, _ = io.WriteString(w, ")")
+	case []interface{}:
+		_, _ = io.WriteString(w, "[")
+		for _, item := range v {
+			writeChecksumValue(w, item)
+			_, _ = io.WriteString(w, ",")
+		}
+		_, _ = io.WriteString(w, "]")
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		_, _ = io.WriteString(w, "{")
+		for _, k := range keys {
+			_, _ = fmt.Fprintf(w, "%q:", k)
+			writeChecksumValue(w, v[k])
+			_, _ = io.WriteString(w, ",")
+		}
+		_, _ = io.WriteString(w, "}")
+	default:
+		_, _ = fmt.Fprintf(w, "%T(%v)", v, v)
+	}
+}
+
+// Counts one more transaction with the given checksum into checksums, respecting maxTrackedChecksums
+func countChecksum(checksums map[string]int64, checksum string, n int64) {
+	if _, found := checksums[checksum]; !found && len(checksums) >= maxTrackedChecksums {
+		checksum = untrackedChecksums
+	}
+	checksums[checksum] += n
+}
+
+// Merges src into dst, returning dst; if dst is nil, returns a copy of src
+func mergeChecksums(dst, src map[string]int64) map[string]int64 {
+	if src == nil {
+		return dst
+	}
+	if dst == nil {
+		dst = make(map[string]int64, len(src))
+	}
+	for checksum, count := range src {
+		countChecksum(dst, checksum, count)
+	}
+	return dst
+}
+
+// Summarizes the checksums of a script; if all its transactions returned the same rows, this is just the checksum
+func describeChecksums(script *ScriptResult) string {
+	var total int64
+	mostCommon := ""
+	for checksum, count := range script.Checksums {
+		total += count
+		if checksum == untrackedChecksums {
+			continue
+		}
+		if mostCommon == "" || count > script.Checksums[mostCommon] ||
+			(count == script.Checksums[mostCommon] && checksum < mostCommon) {
+			mostCommon = checksum
+		}
+	}
+	if len(script.Checksums) == 1 && mostCommon != "" {
+		return fmt.Sprintf("%s (all %d transactions)", mostCommon, total)
+	}
+	distinct := fmt.Sprintf("%d", len(script.Checksums))
+	if _, found := script.Checksums[untrackedChecksums]; found {
+		distinct = fmt.Sprintf("more than %d", maxTrackedChecksums)
+	}
+	return fmt.Sprintf("%s distinct, most common %s (%d of %d transactions)",
+		distinct, mostCommon, script.Checksums[mostCommon], total)
+}
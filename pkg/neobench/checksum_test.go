@@ -0,0 +1,53 @@
+package neobench
+
+import (
+	"fmt"
+	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestResultChecksum(t *testing.T) {
+	checksum := func(mode ChecksumMode, rows ...[]interface{}) string {
+		c := newResultChecksum(mode)
+		var sums [][]byte
+		for _, row := range rows {
+			sums = append(sums, c.rowSum(&neo4j.Record{Keys: []string{"n", "score"}, Values: row}))
+		}
+		c.addStatement(sums)
+		return c.sum()
+	}
+	alice := []interface{}{neo4j.Node{Id: 1, Labels: []string{"Person", "Admin"}, Props: map[string]interface{}{"name": "alice", "age": int64(31)}}, 1.5}
+	aliceElsewhere := []interface{}{neo4j.Node{Id: 1337, Labels: []string{"Admin", "Person"}, Props: map[string]interface{}{"age": int64(31), "name": "alice"}}, 1.5}
+	bob := []interface{}{neo4j.Node{Id: 2, Labels: []string{"Person"}, Props: map[string]interface{}{"name": "bob"}}, 2.0}
+
+	assert.Equal(t, checksum(ChecksumOrdered, alice, bob), checksum(ChecksumOrdered, aliceElsewhere, bob),
+		"node ids and ordering of labels and properties should not matter")
+	assert.NotEqual(t, checksum(ChecksumOrdered, alice, bob), checksum(ChecksumOrdered, bob, alice))
+	assert.Equal(t, checksum(ChecksumUnordered, alice, bob), checksum(ChecksumUnordered, bob, alice))
+	assert.NotEqual(t, checksum(ChecksumUnordered, alice, bob), checksum(ChecksumUnordered, alice, alice))
+	assert.NotEqual(t, checksum(ChecksumOrdered, alice), checksum(ChecksumOrdered, []interface{}{alice[0], "1.5"}),
+		"values of different types should not collide")
+
+	// As when an autocommit statement fails after returning some rows, and is retried
+	retried := newResultChecksum(ChecksumOrdered)
+	_ = retried.rowSum(&neo4j.Record{Keys: []string{"n", "score"}, Values: bob})
+	retried.addStatement([][]byte{retried.rowSum(&neo4j.Record{Keys: []string{"n", "score"}, Values: alice})})
+	assert.Equal(t, checksum(ChecksumOrdered, alice), retried.sum(), "rows of failed attempts should not count")
+}
+
+func TestDescribeChecksums(t *testing.T) {
+	same := &ScriptResult{Checksums: map[string]int64{"aaaa": 10}}
+	assert.Equal(t, "aaaa (all 10 transactions)", describeChecksums(same))
+
+	differing := &ScriptResult{Checksums: map[string]int64{"aaaa": 2, "bbbb": 7, "cccc": 1}}
+	assert.Equal(t, "3 distinct, most common bbbb (7 of 10 transactions)", describeChecksums(differing))
+
+	many := &ScriptResult{Checksums: map[string]int64{}}
+	for i := 0; i < maxTrackedChecksums+10; i++ {
+		countChecksum(many.Checksums, fmt.Sprintf("%04d", i), 1)
+	}
+	countChecksum(many.Checksums, "0000", 1)
+	assert.Len(t, many.Checksums, maxTrackedChecksums+1)
+	assert.Equal(t, "more than 100 distinct, most common 0000 (2 of 111 transactions)", describeChecksums(many))
+}
@@ -2,11 +2,15 @@ package neobench
 
 import (
 	"crypto/tls"
+	"crypto/x509"
 	"fmt"
 	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
 	"github.com/pkg/errors"
 	"io"
+	"net"
 	"net/url"
+	"strings"
+	"syscall"
 )
 
 type EncryptionMode int
@@ -20,12 +24,12 @@ const (
 func NewDriver(urlStr, user, password string, encryptionMode EncryptionMode, checkCertificates bool,
 	configurers ...func(*neo4j.Config)) (neo4j.Driver, error) {
 
-	urlStr, err := determineConnectionUrl(urlStr, encryptionMode, checkCertificates)
+	connUrl, err := determineConnectionUrl(urlStr, encryptionMode, checkCertificates)
 	if err != nil {
 		return nil, errors.Wrapf(err, "failed to determine connection URL to use from %s", urlStr)
 	}
 
-	return neo4j.NewDriver(urlStr, neo4j.BasicAuth(user, password, ""), configurers...)
+	return neo4j.NewDriver(connUrl, neo4j.BasicAuth(user, password, ""), configurers...)
 }
 
 // Modifies the input URL to match encryption and certificate check requirements; by default this is done automatically
@@ -87,3 +91,108 @@ func isTlsEnabled(u *url.URL) (bool, error) {
 	socket.Close()
 	return true, nil
 }
+
+// Kinds of failure to connect that we can give specific advice for
+const (
+	ConnectionFailureAuth    = "authentication failed"
+	ConnectionFailureDns     = "host not found"
+	ConnectionFailureTls     = "TLS handshake failed"
+	ConnectionFailureRefused = "connection refused"
+	ConnectionFailureUnknown = "failed to connect"
+)
+
+// Checks that we can connect, authenticate and run a query against the database before the benchmark starts,
+// so that eg. a typo in the password is reported as such rather than as every transaction failing.
+func VerifyConnectivity(driver neo4j.Driver, urlStr string) error {
+	err := driver.VerifyConnectivity()
+	if err == nil {
+		return nil
+	}
+	return DescribeConnectionError(urlStr, err)
+}
+
+// Classifies an error from connecting to the database into one of the ConnectionFailure kinds
+func ClassifyConnectionError(err error) string {
+	var neo4jErr *neo4j.Neo4jError
+	if errors.As(err, &neo4jErr) && neo4jErr.IsAuthenticationFailed() {
+		return ConnectionFailureAuth
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return ConnectionFailureDns
+	}
+	var certErr x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	if errors.As(err, &certErr) || errors.As(err, &hostnameErr) {
+		return ConnectionFailureTls
+	}
+	if errors.Is(err, syscall.ECONNREFUSED) {
+		return ConnectionFailureRefused
+	}
+
+	// The driver wraps connection errors in types that hide the underlying cause, so for those all we have
+	// to go on is the message
+	msg := err.Error()
+	switch {
+	case strings.Contains(msg, "Security.Unauthorized"):
+		return ConnectionFailureAuth
+	case strings.Contains(msg, "no such host"):
+		return ConnectionFailureDns
+	case strings.Contains(msg, "x509:"), strings.Contains(msg, "tls:"), strings.Contains(msg, "check that TLS is enabled"):
+		return ConnectionFailureTls
+	case strings.Contains(msg, "connection refused"):
+		return ConnectionFailureRefused
+	}
+	return ConnectionFailureUnknown
+}
+
+// Wraps a connection error with advice on how to resolve it
+func DescribeConnectionError(urlStr string, err error) error {
+	var advice string
+	kind := ClassifyConnectionError(err)
+	switch kind {
+	case ConnectionFailureAuth:
+		advice = "check the --user and --password flags"
+	case ConnectionFailureDns:
+		advice = "check the hostname in the --address flag"
+	case ConnectionFailureTls:
+		advice = "check that the server has TLS enabled, or disable it with --encryption false; " +
+			"for self-signed certificates, use --no-check-certificates"
+	case ConnectionFailureRefused:
+		advice = "check that the server is running and that the host and port in the --address flag are correct"
+	default:
+		advice = "check the --address flag and that the server is reachable"
+	}
+	return errors.Errorf("%s connecting to %s, %s: %s", kind, urlStr, advice, err)
+}
+
+// Query parameters with names containing any of these, ignoring case, are assumed to carry credentials
+var sensitiveUrlParams = []string{"pass", "pwd", "secret", "token", "credential", "auth", "key"}
+
+// Removes credentials from a URL, so it can be written to logs and reports. URLs that can't be parsed are
+// redacted entirely, since we can't tell which part of them is the password.
+func RedactUrl(urlStr string) string {
+	u, err := url.Parse(urlStr)
+	if err != nil {
+		return "<redacted unparseable url>"
+	}
+	if u.User != nil {
+		if _, hasPassword := u.User.Password(); hasPassword {
+			u.User = url.UserPassword(u.User.Username(), "redacted")
+		}
+	}
+	if u.RawQuery != "" {
+		query := u.Query()
+		for name := range query {
+			lower := strings.ToLower(name)
+			for _, sensitive := range sensitiveUrlParams {
+				if strings.Contains(lower, sensitive) {
+					query.Set(name, "redacted")
+					break
+				}
+			}
+		}
+		u.RawQuery = query.Encode()
+	}
+	return u.String()
+}
@@ -0,0 +1,44 @@
+package neobench
+
+import (
+	"github.com/pkg/errors"
+	"regexp"
+	"strings"
+)
+
+// Maps errors with messages matching Pattern to the error group Label, see --error-rule
+type ErrorRule struct {
+	Pattern *regexp.Regexp
+	Label   string
+}
+
+// Parses a rule on the form `pattern=>label`, where pattern is a regular expression
+func ParseErrorRule(raw string) (ErrorRule, error) {
+	sep := strings.LastIndex(raw, "=>")
+	if sep < 0 {
+		return ErrorRule{}, errors.Errorf("error rule must be on the form 'pattern=>label', got '%s'", raw)
+	}
+	pattern, label := raw[:sep], strings.TrimSpace(raw[sep+2:])
+	if pattern == "" || label == "" {
+		return ErrorRule{}, errors.Errorf("error rule needs both a pattern and a label, got '%s'", raw)
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return ErrorRule{}, errors.Wrapf(err, "invalid pattern in error rule '%s'", raw)
+	}
+	return ErrorRule{Pattern: re, Label: label}, nil
+}
+
+// Rules are tried in order, and the first one that matches decides the group; errors that match no rule
+// are grouped by their error code, as usual
+type ErrorRules []ErrorRule
+
+func (rules ErrorRules) groupError(err error) string {
+	msg := err.Error()
+	for _, rule := range rules {
+		if rule.Pattern.MatchString(msg) {
+			return rule.Label
+		}
+	}
+	return groupError(err)
+}
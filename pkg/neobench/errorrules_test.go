@@ -0,0 +1,55 @@
+package neobench
+
+import (
+	"fmt"
+	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestParseErrorRule(t *testing.T) {
+	tests := map[string]struct {
+		pattern     string
+		label       string
+		expectError bool
+	}{
+		"lock.*timed out=>lock timeout": {pattern: "lock.*timed out", label: "lock timeout"},
+		"a=>b=>c":                       {pattern: "a=>b", label: "c"},
+		"no separator":                  {expectError: true},
+		"=>label":                       {expectError: true},
+		"pattern=>":                     {expectError: true},
+		"([unclosed=>label":             {expectError: true},
+	}
+
+	for given, tc := range tests {
+		given, tc := given, tc
+		t.Run(given, func(t *testing.T) {
+			rule, err := ParseErrorRule(given)
+			if tc.expectError {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.pattern, rule.Pattern.String())
+			assert.Equal(t, tc.label, rule.Label)
+		})
+	}
+}
+
+func TestErrorRulesApplyInOrderBeforeDefaultGrouping(t *testing.T) {
+	rules := ErrorRules{}
+	for _, raw := range []string{"(?i)lock.*timed out=>lock timeout", "timed out=>other timeout"} {
+		rule, err := ParseErrorRule(raw)
+		assert.NoError(t, err)
+		rules = append(rules, rule)
+	}
+
+	lockErr := &neo4j.Neo4jError{Code: "Neo.TransientError.General.Unknown", Msg: "Lock acquisition timed out on node 12"}
+	otherTimeout := fmt.Errorf("read timed out")
+	deadlock := &neo4j.Neo4jError{Code: "Neo.TransientError.Transaction.DeadlockDetected", Msg: "deadlock"}
+
+	assert.Equal(t, "lock timeout", rules.groupError(lockErr))
+	assert.Equal(t, "other timeout", rules.groupError(otherTimeout))
+	assert.Equal(t, "Neo.TransientError.Transaction.DeadlockDetected", rules.groupError(deadlock))
+	assert.Equal(t, "Neo.TransientError.General.Unknown", ErrorRules(nil).groupError(lockErr))
+}
@@ -0,0 +1,72 @@
+package neobench
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Counts transactions that failed in a row, across all workers, and trips once a limit is reached; used by
+// --abort-after-failures to stop hammering a database that has gone away.
+type FailureStreak struct {
+	mut       sync.Mutex
+	limit     int64
+	count     int64
+	lastGroup string
+	// While suspended, failures don't count, see Suspend
+	suspended bool
+	tripped   chan struct{}
+	once      sync.Once
+}
+
+// limit is the number of consecutive failures that trips the streak, must be at least 1
+func NewFailureStreak(limit int64) *FailureStreak {
+	return &FailureStreak{
+		limit:   limit,
+		tripped: make(chan struct{}),
+	}
+}
+
+func (f *FailureStreak) record(outcome uowOutcome) {
+	f.mut.Lock()
+	defer f.mut.Unlock()
+	if outcome.succeeded {
+		f.count = 0
+		return
+	}
+	if f.suspended {
+		return
+	}
+	f.count++
+	f.lastGroup = outcome.failureGroup
+	if f.count >= f.limit {
+		f.once.Do(func() { close(f.tripped) })
+	}
+}
+
+// Stops counting failures until Resume; for when they are expected, like while --between-phases-cmd restarts the
+// database
+func (f *FailureStreak) Suspend() {
+	f.mut.Lock()
+	defer f.mut.Unlock()
+	f.suspended = true
+}
+
+// Counts failures again, starting from a clean streak
+func (f *FailureStreak) Resume() {
+	f.mut.Lock()
+	defer f.mut.Unlock()
+	f.suspended = false
+	f.count = 0
+}
+
+// Closed once the limit of consecutive failures has been reached
+func (f *FailureStreak) Tripped() <-chan struct{} {
+	return f.tripped
+}
+
+// Describes why the streak tripped, for telling the user why the run was aborted
+func (f *FailureStreak) Reason() string {
+	f.mut.Lock()
+	defer f.mut.Unlock()
+	return fmt.Sprintf("%d transactions in a row failed, most recently with %s", f.limit, f.lastGroup)
+}
@@ -0,0 +1,52 @@
+package neobench
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestFailureStreakTripsOnConsecutiveFailuresOnly(t *testing.T) {
+	streak := NewFailureStreak(3)
+	failed := uowOutcome{succeeded: false, failureGroup: "Neo.TransientError.General.DatabaseUnavailable"}
+
+	streak.record(failed)
+	streak.record(failed)
+	streak.record(uowOutcome{succeeded: true})
+	streak.record(failed)
+	streak.record(failed)
+	assert.False(t, isClosed(streak.Tripped()))
+
+	streak.record(failed)
+	assert.True(t, isClosed(streak.Tripped()))
+	assert.Equal(t, "3 transactions in a row failed, most recently with Neo.TransientError.General.DatabaseUnavailable", streak.Reason())
+
+	// Further failures don't close the channel again
+	streak.record(failed)
+}
+
+func TestFailureStreakIgnoresFailuresWhileSuspended(t *testing.T) {
+	streak := NewFailureStreak(2)
+	failed := uowOutcome{succeeded: false, failureGroup: "Neo.TransientError.General.DatabaseUnavailable"}
+
+	streak.record(failed)
+	streak.Suspend()
+	streak.record(failed)
+	streak.record(failed)
+	assert.False(t, isClosed(streak.Tripped()))
+
+	// Resuming starts a new streak, so the failure before suspending doesn't count either
+	streak.Resume()
+	streak.record(failed)
+	assert.False(t, isClosed(streak.Tripped()))
+	streak.record(failed)
+	assert.True(t, isClosed(streak.Tripped()))
+}
+
+func isClosed(ch <-chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
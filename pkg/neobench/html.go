@@ -0,0 +1,331 @@
+package neobench
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"math"
+	"strings"
+	"time"
+)
+
+// Writes a single, self-contained HTML page with a summary table and charts of the run when it completes; for
+// sharing results with people who won't read CSV. Charts are inline SVG, so the file opens anywhere without
+// network access. The full result and the progress time series are embedded as JSON for anyone wanting the
+// underlying numbers. Progress and errors go to ErrStream while the run is going.
+type HtmlOutput struct {
+	ErrStream io.Writer
+	OutStream io.Writer
+
+	url     string
+	started time.Time
+	// Throughput at each progress report, for the throughput-over-time chart
+	timeSeries []htmlTimePoint
+
+	// Used to rate-limit progress reporting
+	LastProgressReport ProgressReport
+	LastProgressTime   time.Time
+}
+
+type htmlTimePoint struct {
+	Elapsed   float64 `json:"elapsed_seconds"`
+	Rate      float64 `json:"transactions_per_second"`
+	Succeeded int64   `json:"succeeded"`
+	Failed    int64   `json:"failed"`
+	// The latest server metrics sample at the time, see --server-metrics-url
+	ServerMetrics map[string]float64 `json:"server_metrics,omitempty"`
+}
+
+// Percentiles plotted in the latency distribution chart
+var htmlPercentiles = []float64{0, 25, 50, 75, 90, 95, 99, 99.9, 99.99, 99.999, 100}
+
+var htmlPalette = []string{"#1f77b4", "#ff7f0e", "#2ca02c", "#d62728", "#9467bd", "#8c564b", "#e377c2", "#7f7f7f"}
+
+func (o *HtmlOutput) BenchmarkStart(databaseName, url, scenario string) {
+	o.url = RedactUrl(url)
+	o.started = time.Now()
+	if databaseName == "" {
+		databaseName = "<default>"
+	}
+	_, err := fmt.Fprintf(o.ErrStream,
+		"Starting workload on database %s against %s\n"+
+			"Scenario: %s\n", databaseName, url, scenario)
+	if err != nil {
+		panic(err)
+	}
+}
+
+func (o *HtmlOutput) ReportInitProgress(report ProgressReport) {
+	now := time.Now()
+	if report.Section == o.LastProgressReport.Section && report.Step == o.LastProgressReport.Step && now.Sub(o.LastProgressTime).Seconds() < 10 {
+		return
+	}
+	o.LastProgressReport = report
+	o.LastProgressTime = now
+	_, err := fmt.Fprintf(o.ErrStream, "[%s][%s] %.02f%%\n", report.Section, report.Step, report.Completeness*100)
+	if err != nil {
+		panic(err)
+	}
+}
+
+func (o *HtmlOutput) ReportWorkloadProgress(completeness float64, checkpoint Result) {
+	point := htmlTimePoint{
+		Elapsed:   time.Since(o.started).Seconds(),
+		Rate:      checkpoint.TotalRate(),
+		Succeeded: checkpoint.TotalSucceeded(),
+		Failed:    checkpoint.TotalFailed(),
+	}
+	if n := len(checkpoint.ServerMetrics); n > 0 {
+		point.ServerMetrics = checkpoint.ServerMetrics[n-1].Values
+	}
+	o.timeSeries = append(o.timeSeries, point)
+	_, err := fmt.Fprintf(o.ErrStream, "[workload] %.02f%% done\n", completeness*100)
+	if err != nil {
+		panic(err)
+	}
+}
+
+func (o *HtmlOutput) ReportThroughput(result Result) {
+	o.render(result, false)
+}
+
+func (o *HtmlOutput) ReportLatency(result Result) {
+	o.render(result, true)
+}
+
+func (o *HtmlOutput) Errorf(format string, a ...interface{}) {
+	_, err := fmt.Fprintf(o.ErrStream, "ERROR: %s\n", fmt.Sprintf(format, a...))
+	if err != nil {
+		panic(err)
+	}
+}
+
+// The report is written when the run completes, before any plan is taken, so plans go to ErrStream
+func (o *HtmlOutput) ReportPlan(scriptName, plan string) {
+	writePlan(o.ErrStream, scriptName, plan)
+}
+
+func (o *HtmlOutput) ReportSuite(suite SuiteResult, latencyMode bool) {
+	writeSuiteReport(o.ErrStream, plainNumbers{}, suite, latencyMode)
+}
+
+var _ Output = &HtmlOutput{}
+
+type htmlScriptRow struct {
+	Name                       string
+	Succeeded, Failed          int64
+	Rate, Mean, P50, P99, P100 float64
+}
+
+func (o *HtmlOutput) render(result Result, latencyMode bool) {
+	saved := &bytes.Buffer{}
+	if err := SaveResult(saved, result, latencyMode); err != nil {
+		panic(err)
+	}
+	timeSeries, err := json.Marshal(o.timeSeries)
+	if err != nil {
+		panic(err)
+	}
+
+	database := result.DatabaseName
+	if database == "" {
+		database = "<default>"
+	}
+	data := map[string]interface{}{
+		"Database":    database,
+		"Url":         o.url,
+		"Scenario":    result.Scenario,
+		"LatencyMode": latencyMode,
+		"Generated":   time.Now().UTC().Format(time.RFC3339),
+		"Succeeded":   result.TotalSucceeded(),
+		"Failed":      result.TotalFailed(),
+		"Rate":        result.TotalRate(),
+		"Scripts":     htmlScriptRows(result),
+		"NotExecuted": result.NotExecuted(),
+		"Latencies":   htmlLatencyChart(result),
+		"Throughput":  htmlThroughputChart(o.timeSeries),
+		"Errors":      htmlErrorChart(result),
+		// Already valid JSON; template.JS keeps it from being escaped as a string
+		"ResultJson":     template.JS(saved.String()),
+		"TimeSeriesJson": template.JS(timeSeries),
+	}
+	if err := htmlReportTemplate.Execute(o.OutStream, data); err != nil {
+		panic(err)
+	}
+	flushStream(o.OutStream, true)
+}
+
+func htmlScriptRows(result Result) []htmlScriptRow {
+	rows := make([]htmlScriptRow, 0, len(result.Scripts))
+	for _, s := range result.SortedScripts() {
+		rows = append(rows, htmlScriptRow{
+			Name:      s.ScriptName,
+			Succeeded: s.Succeeded,
+			Failed:    s.Failed,
+			Rate:      s.Rate,
+			Mean:      s.Millis(s.Latencies.Mean()),
+			P50:       s.Millis(float64(s.Latencies.ValueAtQuantile(50))),
+			P99:       s.Millis(float64(s.Latencies.ValueAtQuantile(99))),
+			P100:      s.Millis(float64(s.Latencies.Max())),
+		})
+	}
+	return rows
+}
+
+type chartSeries struct {
+	name   string
+	values []float64
+}
+
+// Latency at each of htmlPercentiles, one line per script
+func htmlLatencyChart(result Result) template.HTML {
+	series := make([]chartSeries, 0, len(result.Scripts))
+	for _, s := range result.SortedScripts() {
+		if !s.Executed() {
+			continue
+		}
+		values := make([]float64, 0, len(htmlPercentiles))
+		for _, p := range htmlPercentiles {
+			values = append(values, s.Millis(float64(s.Latencies.ValueAtQuantile(p))))
+		}
+		series = append(series, chartSeries{name: s.ScriptName, values: values})
+	}
+	labels := make([]string, 0, len(htmlPercentiles))
+	for _, p := range htmlPercentiles {
+		labels = append(labels, fmt.Sprintf("p%g", p))
+	}
+	return svgLineChart(series, labels, "ms")
+}
+
+func htmlThroughputChart(points []htmlTimePoint) template.HTML {
+	if len(points) == 0 {
+		return ""
+	}
+	values := make([]float64, 0, len(points))
+	labels := make([]string, 0, len(points))
+	for _, p := range points {
+		values = append(values, p.Rate)
+		labels = append(labels, fmt.Sprintf("%.0fs", p.Elapsed))
+	}
+	return svgLineChart([]chartSeries{{name: "all scripts", values: values}}, labels, "tx/s")
+}
+
+func htmlErrorChart(result Result) template.HTML {
+	groups := result.SortedErrorGroups()
+	if len(groups) == 0 {
+		return ""
+	}
+	max := int64(1)
+	for _, g := range groups {
+		if c := result.FailedByErrorGroup[g].Count; c > max {
+			max = c
+		}
+	}
+	const width, barHeight, labelWidth = 760.0, 22.0, 360.0
+	svg := &strings.Builder{}
+	svg.WriteString(fmt.Sprintf(`<svg xmlns="http://www.w3.org/2000/svg" width="%.0f" height="%.0f">`, width, barHeight*float64(len(groups))+4))
+	for i, g := range groups {
+		count := result.FailedByErrorGroup[g].Count
+		y := float64(i) * barHeight
+		barWidth := (width - labelWidth - 80) * float64(count) / float64(max)
+		svg.WriteString(fmt.Sprintf(`<text x="%.0f" y="%.1f" text-anchor="end" font-size="12">%s</text>`, labelWidth-6, y+15, template.HTMLEscapeString(g)))
+		svg.WriteString(fmt.Sprintf(`<rect x="%.0f" y="%.1f" width="%.1f" height="%.0f" fill="%s"/>`, labelWidth, y+3, barWidth, barHeight-6, htmlPalette[3]))
+		svg.WriteString(fmt.Sprintf(`<text x="%.1f" y="%.1f" font-size="12">%d</text>`, labelWidth+barWidth+4, y+15, count))
+	}
+	svg.WriteString(`</svg>`)
+	return template.HTML(svg.String())
+}
+
+// Plots each series as a line over evenly spaced x positions, labelled with xLabels
+func svgLineChart(series []chartSeries, xLabels []string, unit string) template.HTML {
+	const width, height, left, right, top, bottom = 760.0, 300.0, 70.0, 20.0, 20.0, 40.0
+	max := 0.0
+	for _, s := range series {
+		for _, v := range s.values {
+			max = math.Max(max, v)
+		}
+	}
+	if max == 0 {
+		max = 1
+	}
+	x := func(i int) float64 {
+		if len(xLabels) < 2 {
+			return left
+		}
+		return left + (width-left-right)*float64(i)/float64(len(xLabels)-1)
+	}
+	y := func(v float64) float64 { return top + (height-top-bottom)*(1-v/max) }
+
+	svg := &strings.Builder{}
+	svg.WriteString(fmt.Sprintf(`<svg xmlns="http://www.w3.org/2000/svg" width="%.0f" height="%.0f">`, width, height+float64(len(series))*18))
+	// Axes, with gridlines at quarters of the max
+	for i := 0; i <= 4; i++ {
+		v := max * float64(i) / 4
+		svg.WriteString(fmt.Sprintf(`<line x1="%.0f" y1="%.1f" x2="%.0f" y2="%.1f" stroke="#ddd"/>`, left, y(v), width-right, y(v)))
+		svg.WriteString(fmt.Sprintf(`<text x="%.0f" y="%.1f" text-anchor="end" font-size="11">%.3g %s</text>`, left-6, y(v)+4, v, unit))
+	}
+	step := 1
+	if len(xLabels) > 12 {
+		step = (len(xLabels) + 11) / 12
+	}
+	for i := 0; i < len(xLabels); i += step {
+		svg.WriteString(fmt.Sprintf(`<text x="%.1f" y="%.0f" text-anchor="middle" font-size="11">%s</text>`, x(i), height-bottom+16, template.HTMLEscapeString(xLabels[i])))
+	}
+	for i, s := range series {
+		color := htmlPalette[i%len(htmlPalette)]
+		points := make([]string, 0, len(s.values))
+		for j, v := range s.values {
+			points = append(points, fmt.Sprintf("%.1f,%.1f", x(j), y(v)))
+		}
+		svg.WriteString(fmt.Sprintf(`<polyline fill="none" stroke="%s" stroke-width="2" points="%s"/>`, color, strings.Join(points, " ")))
+		legendY := height + float64(i)*18
+		svg.WriteString(fmt.Sprintf(`<rect x="%.0f" y="%.0f" width="12" height="12" fill="%s"/>`, left, legendY, color))
+		svg.WriteString(fmt.Sprintf(`<text x="%.0f" y="%.0f" font-size="12">%s</text>`, left+18, legendY+10, template.HTMLEscapeString(s.name)))
+	}
+	svg.WriteString(`</svg>`)
+	return template.HTML(svg.String())
+}
+
+var htmlReportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>neobench: {{.Database}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ccc; padding: 4px 10px; text-align: right; }
+th:first-child, td:first-child { text-align: left; }
+code { background: #f4f4f4; padding: 2px 4px; }
+</style>
+</head>
+<body>
+<h1>neobench results</h1>
+<p>Database <b>{{.Database}}</b> at <code>{{.Url}}</code>, generated {{.Generated}}</p>
+<p>Scenario: <code>neobench{{.Scenario}}</code></p>
+<p>{{.Succeeded}} successful transactions, {{.Failed}} failed, {{printf "%.3f" .Rate}} per second in total.</p>
+{{if .NotExecuted}}<p><b>Not executed</b>, no transactions ran for: {{range $i, $name := .NotExecuted}}{{if $i}}, {{end}}{{$name}}{{end}}; check the script weights.</p>{{end}}
+{{if not .LatencyMode}}<p>This was a throughput run; latencies are not meaningful, since clients go as fast as the database lets them.</p>{{end}}
+
+<h2>Scripts</h2>
+<table>
+<tr><th>Script</th><th>Succeeded</th><th>Failed</th><th>Tx/s</th><th>Mean (ms)</th><th>P50 (ms)</th><th>P99 (ms)</th><th>Max (ms)</th></tr>
+{{range .Scripts}}<tr><td>{{.Name}}</td><td>{{.Succeeded}}</td><td>{{.Failed}}</td><td>{{printf "%.3f" .Rate}}</td><td>{{printf "%.3f" .Mean}}</td><td>{{printf "%.3f" .P50}}</td><td>{{printf "%.3f" .P99}}</td><td>{{printf "%.3f" .P100}}</td></tr>
+{{end}}</table>
+
+{{if .LatencyMode}}<h2>Latency distribution</h2>
+{{.Latencies}}
+{{end}}
+{{if .Throughput}}<h2>Throughput over time</h2>
+{{.Throughput}}
+{{end}}
+<h2>Errors</h2>
+{{if .Errors}}{{.Errors}}{{else}}<p>No errors!</p>{{end}}
+
+<script type="application/json" id="neobench-result">{{.ResultJson}}</script>
+<script type="application/json" id="neobench-time-series">{{.TimeSeriesJson}}</script>
+</body>
+</html>
+`))
@@ -0,0 +1,36 @@
+package neobench
+
+// Caps how many transactions may be in flight at once across all workers, see --max-in-flight. With a rate
+// set, this models clients with a limited number of connections: if the database stalls, new transactions
+// queue up client-side, and the time spent queued counts towards their latency.
+//
+// Each worker has at most one transaction in flight, so this only caps anything below the number of workers,
+// and then it holds some of them back rather than stopping new transactions from being launched; a worker that
+// falls behind its schedule catches up once it gets a slot, rather than the pacing waiting for it.
+type InFlightLimit struct {
+	slots chan struct{}
+}
+
+func NewInFlightLimit(max int) *InFlightLimit {
+	return &InFlightLimit{slots: make(chan struct{}, max)}
+}
+
+// Takes a slot, waiting for one to free up if they're all taken. Returns whether it had to wait, and false
+// for ok if stopCh closed before a slot became available.
+func (l *InFlightLimit) acquire(stopCh <-chan struct{}) (waited bool, ok bool) {
+	select {
+	case l.slots <- struct{}{}:
+		return false, true
+	default:
+	}
+	select {
+	case l.slots <- struct{}{}:
+		return true, true
+	case <-stopCh:
+		return true, false
+	}
+}
+
+func (l *InFlightLimit) release() {
+	<-l.slots
+}
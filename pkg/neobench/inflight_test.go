@@ -0,0 +1,32 @@
+package neobench
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestInFlightLimitMakesExcessTransactionsWait(t *testing.T) {
+	limit := NewInFlightLimit(1)
+	stopCh := make(chan struct{})
+
+	waited, ok := limit.acquire(stopCh)
+	assert.False(t, waited)
+	assert.True(t, ok)
+
+	acquired := make(chan bool)
+	go func() {
+		waited, ok := limit.acquire(stopCh)
+		assert.True(t, ok)
+		acquired <- waited
+	}()
+	// Give the goroutine time to find all slots taken
+	time.Sleep(50 * time.Millisecond)
+	limit.release()
+	assert.True(t, <-acquired)
+
+	// Stopping releases anyone still waiting for a slot
+	close(stopCh)
+	_, ok = limit.acquire(stopCh)
+	assert.False(t, ok)
+}
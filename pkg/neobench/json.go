@@ -0,0 +1,269 @@
+package neobench
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/codahale/hdrhistogram"
+	"io"
+	"strconv"
+	"time"
+)
+
+// Latency quantiles reported by json output unless configured otherwise, see JsonOutput.Quantiles
+var DefaultJsonQuantiles = []float64{50, 75, 90, 95, 99, 99.9, 99.99}
+
+// Writes the final result as a single JSON object, with everything needed to archive a run and compare it to
+// later ones: per-script counts and rates, latency quantiles and the full error groups. Unlike ndjson, which is
+// flat for loading into columnar stores, this is nested. Progress and errors go to ErrStream, so OutStream only
+// ever has the result; durations and latencies are in milliseconds, and timestamps in milliseconds since the epoch.
+//
+// Results are held back until Close, and always written as one document of the same shape, {"runs": [...]}, with
+// one object per result, whether there was one, several, like with --sequential, or a suite.
+type JsonOutput struct {
+	ErrStream io.Writer
+	OutStream io.Writer
+	// Latency quantiles to report, as percentiles, ex: 99.9; DefaultJsonQuantiles if empty
+	Quantiles []float64
+	// neobench version, recorded in the output
+	Version string
+	// Used to rate-limit progress reporting
+	LastProgressReport ProgressReport
+	LastProgressTime   time.Time
+	failures           failureTally
+	// When the run of the next result started, as near as we can tell; see writeResult
+	started time.Time
+	runs    []jsonResult
+	suite   *jsonSuite
+}
+
+type jsonDocument struct {
+	Runs []jsonResult `json:"runs"`
+	// Only for suites, see ReportSuite
+	Suite *jsonSuite `json:"suite,omitempty"`
+}
+
+// Totals across the workloads of a suite; each workload is one of the runs, named in its workload field
+type jsonSuite struct {
+	Succeeded int64 `json:"succeeded"`
+	Failed    int64 `json:"failed"`
+}
+
+type jsonResult struct {
+	// Name of the workload, for the runs of a suite
+	Workload          string             `json:"workload,omitempty"`
+	Version           string             `json:"version"`
+	StartedMs         int64              `json:"started_ms"`
+	CompletedMs       int64              `json:"completed_ms"`
+	DurationMs        float64            `json:"duration_ms"`
+	Database          string             `json:"database"`
+	Scenario          string             `json:"scenario"`
+	Mode              string             `json:"mode"`
+	LatencySampleRate float64            `json:"latency_sample_rate"`
+	Succeeded         int64              `json:"succeeded"`
+	Failed            int64              `json:"failed"`
+	Rate              float64            `json:"transactions_per_second"`
+	Scripts           []jsonScriptResult `json:"scripts"`
+	Errors            []jsonFailureGroup `json:"errors"`
+}
+
+type jsonScriptResult struct {
+	Script    string  `json:"script"`
+	Succeeded int64   `json:"succeeded"`
+	Failed    int64   `json:"failed"`
+	Rate      float64 `json:"transactions_per_second"`
+	// Of successful transactions; missing if there were none
+	Latency *jsonLatency `json:"latency,omitempty"`
+	// In latency mode, the split of latency into schedule wait and service time, see ScriptResult.ScheduleWait
+	ScheduleWait *jsonLatency `json:"schedule_wait,omitempty"`
+	ServiceTime  *jsonLatency `json:"service_time,omitempty"`
+}
+
+type jsonLatency struct {
+	MinMs    float64 `json:"min_ms"`
+	MaxMs    float64 `json:"max_ms"`
+	MeanMs   float64 `json:"mean_ms"`
+	StddevMs float64 `json:"stddev_ms"`
+	// By percentile, ex: "p99.9"
+	QuantilesMs map[string]float64 `json:"quantiles_ms"`
+}
+
+type jsonFailureGroup struct {
+	Group        string `json:"group"`
+	Count        int64  `json:"count"`
+	FirstFailure string `json:"first_failure"`
+}
+
+// Checks the quantiles are percentiles, between 0 and 100
+func ValidateJsonQuantiles(quantiles []float64) error {
+	for _, q := range quantiles {
+		if q < 0 || q > 100 {
+			return fmt.Errorf("quantiles are percentiles, so must be between 0 and 100, got %v", q)
+		}
+	}
+	return nil
+}
+
+func (o *JsonOutput) BenchmarkStart(databaseName, url, scenario string) {
+	o.failures.reset()
+	o.started = time.Now()
+	if databaseName == "" {
+		databaseName = "<default>"
+	}
+	_, err := fmt.Fprintf(o.ErrStream,
+		"Starting workload on database %s against %s\n"+
+			"Scenario: %s\n", databaseName, url, scenario)
+	if err != nil {
+		panic(err)
+	}
+}
+
+func (o *JsonOutput) ReportInitProgress(report ProgressReport) {
+	now := time.Now()
+	if report.Section == o.LastProgressReport.Section && report.Step == o.LastProgressReport.Step && now.Sub(o.LastProgressTime).Seconds() < 10 {
+		return
+	}
+	o.LastProgressReport = report
+	o.LastProgressTime = now
+	_, err := fmt.Fprintf(o.ErrStream, "[%s][%s] %.02f%%\n", report.Section, report.Step, report.Completeness*100)
+	if err != nil {
+		panic(err)
+	}
+}
+
+func (o *JsonOutput) ReportWorkloadProgress(completeness float64, checkpoint Result) {
+	_, err := fmt.Fprintf(o.ErrStream, "[workload] %.02f%% done, %s\n", completeness*100, o.failures.describe(plainNumbers{}, checkpoint))
+	if err != nil {
+		panic(err)
+	}
+}
+
+func (o *JsonOutput) ReportThroughput(result Result) {
+	o.addResult(result, "throughput")
+}
+
+func (o *JsonOutput) ReportLatency(result Result) {
+	o.addResult(result, "latency")
+}
+
+// Writes the results reported so far, if any, as one document
+func (o *JsonOutput) Close() error {
+	if len(o.runs) == 0 {
+		return nil
+	}
+	doc := jsonDocument{Runs: o.runs, Suite: o.suite}
+	enc := json.NewEncoder(o.OutStream)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	o.runs, o.suite = nil, nil
+	flushStream(o.OutStream, true)
+	return nil
+}
+
+func (o *JsonOutput) addResult(result Result, mode string) {
+	database := result.DatabaseName
+	if database == "" {
+		database = "<default>"
+	}
+	completed := time.Now()
+	started := o.started
+	if window := completed.Add(-result.Duration); started.IsZero() || started.After(window) {
+		// Rendered from a saved result, so BenchmarkStart, if any, was just now; the measurement window is all
+		// we know
+		started = window
+	}
+	// Benchmarks after the first of --sequential or a suite share its BenchmarkStart, and start as this one ends
+	o.started = completed
+	out := jsonResult{
+		Version:           o.Version,
+		StartedMs:         started.UnixNano() / int64(time.Millisecond),
+		CompletedMs:       completed.UnixNano() / int64(time.Millisecond),
+		DurationMs:        float64(result.Duration) / float64(time.Millisecond),
+		Database:          database,
+		Scenario:          result.Scenario,
+		Mode:              mode,
+		LatencySampleRate: result.LatencySampleRate,
+		Succeeded:         result.TotalSucceeded(),
+		Failed:            result.TotalFailed(),
+		Rate:              result.TotalRate(),
+		Scripts:           make([]jsonScriptResult, 0, len(result.Scripts)),
+		Errors:            make([]jsonFailureGroup, 0, len(result.FailedByErrorGroup)),
+	}
+	for _, s := range result.SortedScripts() {
+		script := jsonScriptResult{
+			Script:    s.ScriptName,
+			Succeeded: s.Succeeded,
+			Failed:    s.Failed,
+			Rate:      s.Rate,
+		}
+		if s.Succeeded > 0 {
+			script.Latency = o.describeLatency(s, s.Latencies)
+			script.ScheduleWait = o.describeLatency(s, s.ScheduleWait)
+			script.ServiceTime = o.describeLatency(s, s.ServiceTime)
+		}
+		out.Scripts = append(out.Scripts, script)
+	}
+	for _, name := range result.SortedErrorGroups() {
+		group := result.FailedByErrorGroup[name]
+		firstFailure := ""
+		if group.FirstFailure != nil {
+			firstFailure = group.FirstFailure.Error()
+		}
+		out.Errors = append(out.Errors, jsonFailureGroup{Group: name, Count: group.Count, FirstFailure: firstFailure})
+	}
+	o.runs = append(o.runs, out)
+}
+
+// nil if there is no such histogram, ex: schedule wait in throughput mode
+func (o *JsonOutput) describeLatency(s *ScriptResult, histo *hdrhistogram.Histogram) *jsonLatency {
+	if histo == nil {
+		return nil
+	}
+	quantiles := o.Quantiles
+	if len(quantiles) == 0 {
+		quantiles = DefaultJsonQuantiles
+	}
+	out := &jsonLatency{
+		MinMs:       s.Millis(float64(histo.Min())),
+		MaxMs:       s.Millis(float64(histo.Max())),
+		MeanMs:      s.Millis(histo.Mean()),
+		StddevMs:    s.Millis(histo.StdDev()),
+		QuantilesMs: make(map[string]float64, len(quantiles)),
+	}
+	for _, q := range quantiles {
+		out.QuantilesMs["p"+strconv.FormatFloat(q, 'f', -1, 64)] = s.Millis(float64(histo.ValueAtQuantile(q)))
+	}
+	return out
+}
+
+func (o *JsonOutput) Errorf(format string, a ...interface{}) {
+	_, err := fmt.Fprintf(o.ErrStream, "ERROR: %s\n", fmt.Sprintf(format, a...))
+	if err != nil {
+		panic(err)
+	}
+}
+
+// Plans go to ErrStream, so OutStream stays parseable
+func (o *JsonOutput) ReportPlan(scriptName, plan string) {
+	writePlan(o.ErrStream, scriptName, plan)
+}
+
+// Each workload of the suite has been reported as it completed, in order, so the last runs are the suite's; they
+// are named after their workloads, and the suite totals added to the document. The suite report goes to ErrStream.
+func (o *JsonOutput) ReportSuite(suite SuiteResult, latencyMode bool) {
+	writeSuiteReport(o.ErrStream, plainNumbers{}, suite, latencyMode)
+	if len(o.runs) < len(suite.Names) {
+		return
+	}
+	runs := o.runs[len(o.runs)-len(suite.Names):]
+	o.suite = &jsonSuite{}
+	for i, name := range suite.Names {
+		runs[i].Workload = name
+		o.suite.Succeeded += runs[i].Succeeded
+		o.suite.Failed += runs[i].Failed
+	}
+}
+
+var _ Output = &JsonOutput{}
+var _ io.Closer = &JsonOutput{}
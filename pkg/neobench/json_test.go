@@ -0,0 +1,127 @@
+package neobench
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestJsonOutputWritesResultAsSingleObject(t *testing.T) {
+	worker := NewWorkerResult(0)
+	for i := 0; i < 10; i++ {
+		assert.NoError(t, worker.record("write.script", 2*time.Millisecond, uowOutcome{succeeded: true}, true))
+	}
+	assert.NoError(t, worker.record("write.script", time.Millisecond,
+		uowOutcome{failureGroup: "deadlock", err: errors.New("deadlock detected")}, true))
+	assert.NoError(t, worker.record("read.script", time.Millisecond, uowOutcome{failureGroup: "deadlock"}, true))
+	result := NewResult("", " -f write.script -f read.script")
+	result.Add(worker)
+	result.ReconcileRates(time.Second)
+
+	out, errOut := &bytes.Buffer{}, &bytes.Buffer{}
+	o := &JsonOutput{OutStream: out, ErrStream: errOut, Quantiles: []float64{50, 99.9}, Version: "1.2.3"}
+	o.ReportThroughput(result)
+	assert.Empty(t, out.String(), "held back until closed")
+	assert.NoError(t, o.Close())
+
+	assert.Empty(t, errOut.String())
+	var doc jsonDocument
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &doc))
+	assert.Nil(t, doc.Suite)
+	assert.Len(t, doc.Runs, 1, "the same envelope as for several results")
+	decoded := doc.Runs[0]
+	assert.Equal(t, "1.2.3", decoded.Version)
+	assert.Equal(t, "<default>", decoded.Database)
+	assert.Equal(t, "throughput", decoded.Mode)
+	assert.Equal(t, int64(10), decoded.Succeeded)
+	assert.Equal(t, int64(2), decoded.Failed)
+	assert.Equal(t, []jsonFailureGroup{{Group: "deadlock", Count: 2, FirstFailure: "deadlock detected"}}, decoded.Errors)
+
+	assert.Len(t, decoded.Scripts, 2)
+	read, write := decoded.Scripts[0], decoded.Scripts[1]
+	assert.Equal(t, "read.script", read.Script)
+	assert.Nil(t, read.Latency, "no successful transactions, so no latencies to report")
+	assert.Equal(t, "write.script", write.Script)
+	assert.Equal(t, 11.0, write.Rate)
+	assert.Equal(t, map[string]float64{"p50": 2.0, "p99.9": 2.0}, write.Latency.QuantilesMs)
+	assert.Equal(t, 2.0, write.Latency.MaxMs)
+}
+
+func TestJsonOutputWritesSeveralResultsAsOneDocument(t *testing.T) {
+	out, errOut := &bytes.Buffer{}, &bytes.Buffer{}
+	o := &JsonOutput{OutStream: out, ErrStream: errOut}
+	for _, script := range []string{"write.script", "read.script"} {
+		worker := NewWorkerResult(0)
+		assert.NoError(t, worker.record(script, time.Millisecond, uowOutcome{succeeded: true}, true))
+		result := NewResult("neo4j", " -f "+script)
+		result.Add(worker)
+		result.ReconcileRates(time.Second)
+
+		o.BenchmarkStart("neo4j", "neo4j://localhost", " -f "+script)
+		o.ReportLatency(result)
+	}
+	assert.NoError(t, o.Close())
+
+	var decoded jsonDocument
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &decoded))
+	assert.Nil(t, decoded.Suite)
+	assert.Len(t, decoded.Runs, 2)
+	assert.Equal(t, " -f write.script", decoded.Runs[0].Scenario)
+	assert.Equal(t, "write.script", decoded.Runs[0].Scripts[0].Script)
+	assert.Equal(t, " -f read.script", decoded.Runs[1].Scenario)
+	assert.Equal(t, "latency", decoded.Runs[1].Mode)
+}
+
+func TestJsonOutputWritesSuiteAsOneDocument(t *testing.T) {
+	out := &bytes.Buffer{}
+	o := &JsonOutput{OutStream: out, ErrStream: &bytes.Buffer{}}
+	suite := NewSuiteResult()
+	o.BenchmarkStart("neo4j", "neo4j://localhost", " suite write.script read.script")
+	for _, name := range []string{"write", "read"} {
+		worker := NewWorkerResult(0)
+		assert.NoError(t, worker.record(name+".script", time.Millisecond, uowOutcome{succeeded: true}, true))
+		assert.NoError(t, worker.record(name+".script", time.Millisecond, uowOutcome{failureGroup: "deadlock"}, true))
+		result := NewResult("neo4j", " -f "+name+".script")
+		result.Add(worker)
+		result.ReconcileRates(time.Second)
+		o.ReportThroughput(result)
+		suite.Add(name, result)
+	}
+	o.ReportSuite(suite, false)
+	assert.NoError(t, o.Close())
+
+	var decoded jsonDocument
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &decoded))
+	assert.Equal(t, &jsonSuite{Succeeded: 2, Failed: 2}, decoded.Suite)
+	assert.Len(t, decoded.Runs, 2)
+	assert.Equal(t, "write", decoded.Runs[0].Workload)
+	assert.Equal(t, " -f write.script", decoded.Runs[0].Scenario)
+	assert.Equal(t, "read", decoded.Runs[1].Workload)
+	assert.Equal(t, "read.script", decoded.Runs[1].Scripts[0].Script)
+}
+
+func TestValidateJsonQuantiles(t *testing.T) {
+	tests := map[string]struct {
+		quantiles []float64
+		valid     bool
+	}{
+		"defaults":    {nil, true},
+		"whole range": {[]float64{0, 50, 99.999, 100}, true},
+		"above 100":   {[]float64{50, 100.1}, false},
+		"negative":    {[]float64{-1}, false},
+	}
+	for name, tc := range tests {
+		name, tc := name, tc
+		t.Run(name, func(t *testing.T) {
+			err := ValidateJsonQuantiles(tc.quantiles)
+			if tc.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
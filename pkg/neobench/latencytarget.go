@@ -0,0 +1,68 @@
+package neobench
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A latency percentile that must not exceed Max for the run to pass, see --latency-target
+type LatencyTarget struct {
+	// Between 0 and 100, ex: 99.9
+	Percentile float64
+	Max        time.Duration
+}
+
+// Parses a target on the form `p99.9=200ms`
+func ParseLatencyTarget(raw string) (LatencyTarget, error) {
+	parts := strings.SplitN(strings.TrimSpace(raw), "=", 2)
+	if len(parts) != 2 || !strings.HasPrefix(parts[0], "p") {
+		return LatencyTarget{}, errors.Errorf("latency target must be on the form 'p99=50ms', got '%s'", raw)
+	}
+	percentile, err := strconv.ParseFloat(parts[0][1:], 64)
+	if err != nil || percentile < 0 || percentile > 100 {
+		return LatencyTarget{}, errors.Errorf("latency target percentile must be between p0 and p100, got '%s'", parts[0])
+	}
+	max, err := time.ParseDuration(parts[1])
+	if err != nil {
+		return LatencyTarget{}, errors.Wrapf(err, "invalid duration in latency target '%s'", raw)
+	}
+	return LatencyTarget{Percentile: percentile, Max: max}, nil
+}
+
+func (t LatencyTarget) String() string {
+	return fmt.Sprintf("p%s=%s", strconv.FormatFloat(t.Percentile, 'f', -1, 64), t.Max)
+}
+
+// A script whose latency at the target percentile was above the target
+type LatencyTargetMiss struct {
+	ScriptName string
+	Target     LatencyTarget
+	Actual     time.Duration
+}
+
+func (m LatencyTargetMiss) String() string {
+	return fmt.Sprintf("%s: p%s was %.3fms, target is at most %.3fms", m.ScriptName,
+		strconv.FormatFloat(m.Target.Percentile, 'f', -1, 64),
+		float64(m.Actual)/float64(time.Millisecond), float64(m.Target.Max)/float64(time.Millisecond))
+}
+
+// Checks each target against the latencies of each script that ran; scripts that didn't run a single
+// transaction have no latencies to check, and are reported as not executed instead
+func CheckLatencyTargets(result Result, targets []LatencyTarget) []LatencyTargetMiss {
+	misses := make([]LatencyTargetMiss, 0)
+	for _, script := range result.SortedScripts() {
+		if !script.Executed() {
+			continue
+		}
+		for _, target := range targets {
+			actual := time.Duration(script.Millis(float64(script.Latencies.ValueAtQuantile(target.Percentile))) * float64(time.Millisecond))
+			if actual > target.Max {
+				misses = append(misses, LatencyTargetMiss{ScriptName: script.ScriptName, Target: target, Actual: actual})
+			}
+		}
+	}
+	return misses
+}
@@ -0,0 +1,60 @@
+package neobench
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestParseLatencyTarget(t *testing.T) {
+	tests := map[string]struct {
+		expected LatencyTarget
+		err      bool
+	}{
+		"p50=5ms":     {expected: LatencyTarget{Percentile: 50, Max: 5 * time.Millisecond}},
+		"p99.9=200ms": {expected: LatencyTarget{Percentile: 99.9, Max: 200 * time.Millisecond}},
+		"99=50ms":     {err: true},
+		"p101=50ms":   {err: true},
+		"p99":         {err: true},
+		"p99=fast":    {err: true},
+	}
+
+	for raw, tc := range tests {
+		raw, tc := raw, tc
+		t.Run(raw, func(t *testing.T) {
+			target, err := ParseLatencyTarget(raw)
+			if tc.err {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, target)
+			assert.Equal(t, raw, target.String())
+		})
+	}
+}
+
+func TestCheckLatencyTargets(t *testing.T) {
+	result := NewResult("", "")
+	fast := &ScriptResult{ScriptName: "fast", Succeeded: 100, Latencies: newLatencyHistogram(DefaultLatencyResolution)}
+	slow := &ScriptResult{ScriptName: "slow", Succeeded: 100, Latencies: newLatencyHistogram(DefaultLatencyResolution)}
+	for i := int64(1); i <= 100; i++ {
+		assert.NoError(t, fast.Latencies.RecordValue(i*10))
+		assert.NoError(t, slow.Latencies.RecordValue(i*1000))
+	}
+	result.Scripts["fast"] = fast
+	result.Scripts["slow"] = slow
+	result.Scripts["idle"] = &ScriptResult{ScriptName: "idle", Latencies: newLatencyHistogram(DefaultLatencyResolution)}
+
+	misses := CheckLatencyTargets(result, []LatencyTarget{
+		{Percentile: 50, Max: 5 * time.Millisecond},
+		{Percentile: 99, Max: 50 * time.Millisecond},
+	})
+
+	assert.Len(t, misses, 2)
+	assert.Equal(t, "slow", misses[0].ScriptName)
+	assert.Equal(t, 50.0, misses[0].Target.Percentile)
+	assert.Equal(t, "slow", misses[1].ScriptName)
+	assert.Equal(t, 99.0, misses[1].Target.Percentile)
+	assert.InDelta(t, 99*time.Millisecond, misses[1].Actual, float64(time.Millisecond))
+}
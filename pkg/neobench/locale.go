@@ -0,0 +1,61 @@
+package neobench
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+	"strings"
+)
+
+// Formats numbers for people to read; localeNumbers formats them per locale, with thousands separators and
+// the local decimal mark. Only used for human-readable output; CSV, JSON and the like are always plainNumbers.
+type numberFormat interface {
+	Sprintf(format string, a ...interface{}) string
+}
+
+type plainNumbers struct{}
+
+func (plainNumbers) Sprintf(format string, a ...interface{}) string {
+	return fmt.Sprintf(format, a...)
+}
+
+type localeNumbers struct {
+	printer *message.Printer
+}
+
+func (l localeNumbers) Sprintf(format string, a ...interface{}) string {
+	return l.printer.Sprintf(format, a...)
+}
+
+// Printer for the locale given with --locale, or if that is empty, for the locale set in the environment with
+// LC_ALL, LC_NUMERIC or LANG, in that order of precedence. Returns nil, meaning plain formatting, if no locale
+// is set or it is C or POSIX. Locales from the environment that can't be parsed are ignored, since they were
+// not set for neobench.
+func LocalePrinter(raw string, lookupEnv func(string) (string, bool)) (*message.Printer, error) {
+	explicit := raw != ""
+	if !explicit {
+		for _, name := range []string{"LC_ALL", "LC_NUMERIC", "LANG"} {
+			if value, found := lookupEnv(name); found && value != "" {
+				raw = value
+				break
+			}
+		}
+	}
+	// POSIX locale names look like de_DE.UTF-8 or de_DE@euro; BCP 47 wants de-DE
+	name := raw
+	if i := strings.IndexAny(name, ".@"); i >= 0 {
+		name = name[:i]
+	}
+	if name == "" || name == "C" || name == "POSIX" {
+		return nil, nil
+	}
+	tag, err := language.Parse(strings.ReplaceAll(name, "_", "-"))
+	if err != nil {
+		if explicit {
+			return nil, errors.Wrapf(err, "unknown locale '%s'", raw)
+		}
+		return nil, nil
+	}
+	return message.NewPrinter(tag), nil
+}
@@ -0,0 +1,40 @@
+package neobench
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestLocalePrinter(t *testing.T) {
+	tests := map[string]struct {
+		flag     string
+		env      map[string]string
+		expected string
+		err      bool
+	}{
+		"not set":             {expected: "1234567.891"},
+		"from flag":           {flag: "de_DE", expected: "1.234.567,891"},
+		"from LANG":           {env: map[string]string{"LANG": "de_DE.UTF-8"}, expected: "1.234.567,891"},
+		"LC_ALL wins":         {env: map[string]string{"LC_ALL": "en_US.UTF-8", "LANG": "de_DE.UTF-8"}, expected: "1,234,567.891"},
+		"flag wins":           {flag: "C", env: map[string]string{"LANG": "de_DE.UTF-8"}, expected: "1234567.891"},
+		"bad env is ignored":  {env: map[string]string{"LANG": "not a locale"}, expected: "1234567.891"},
+		"bad flag is refused": {flag: "not a locale", err: true},
+	}
+
+	for name, tc := range tests {
+		name, tc := name, tc
+		t.Run(name, func(t *testing.T) {
+			printer, err := LocalePrinter(tc.flag, func(key string) (string, bool) {
+				value, found := tc.env[key]
+				return value, found
+			})
+			if tc.err {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			o := &InteractiveOutput{Printer: printer}
+			assert.Equal(t, tc.expected, o.numbers().Sprintf("%.3f", 1234567.891))
+		})
+	}
+}
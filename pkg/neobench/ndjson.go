@@ -0,0 +1,160 @@
+package neobench
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Writes one flat JSON object per script, one per line, when the run completes. The fields are fixed and always
+// present, so the output can be loaded straight into columnar stores like BigQuery; see docs/overview.md for the
+// schema. Progress and errors go to ErrStream.
+type NdjsonOutput struct {
+	ErrStream io.Writer
+	OutStream io.Writer
+	// Used to rate-limit progress reporting
+	LastProgressReport ProgressReport
+	LastProgressTime   time.Time
+	failures           failureTally
+}
+
+// One line of ndjson output. Changing this changes the documented schema; add fields rather than changing
+// or removing existing ones.
+type ndjsonRecord struct {
+	Timestamp         string  `json:"timestamp"`
+	Database          string  `json:"database"`
+	Scenario          string  `json:"scenario"`
+	Mode              string  `json:"mode"`
+	Script            string  `json:"script"`
+	Succeeded         int64   `json:"succeeded"`
+	Failed            int64   `json:"failed"`
+	Rate              float64 `json:"transactions_per_second"`
+	LatencySampleRate float64 `json:"latency_sample_rate"`
+	MeanMs            float64 `json:"latency_mean_ms"`
+	StddevMs          float64 `json:"latency_stddev_ms"`
+	P0Ms              float64 `json:"latency_p0_ms"`
+	P25Ms             float64 `json:"latency_p25_ms"`
+	P50Ms             float64 `json:"latency_p50_ms"`
+	P75Ms             float64 `json:"latency_p75_ms"`
+	P95Ms             float64 `json:"latency_p95_ms"`
+	P99Ms             float64 `json:"latency_p99_ms"`
+	P99999Ms          float64 `json:"latency_p99999_ms"`
+	P100Ms            float64 `json:"latency_p100_ms"`
+	ScheduleWaitP50Ms float64 `json:"schedule_wait_p50_ms"`
+	ScheduleWaitP99Ms float64 `json:"schedule_wait_p99_ms"`
+	ServiceP50Ms      float64 `json:"service_p50_ms"`
+	ServiceP99Ms      float64 `json:"service_p99_ms"`
+}
+
+func (o *NdjsonOutput) BenchmarkStart(databaseName, url, scenario string) {
+	o.failures.reset()
+	if databaseName == "" {
+		databaseName = "<default>"
+	}
+	_, err := fmt.Fprintf(o.ErrStream,
+		"Starting workload on database %s against %s\n"+
+			"Scenario: %s\n", databaseName, url, scenario)
+	if err != nil {
+		panic(err)
+	}
+}
+
+func (o *NdjsonOutput) ReportInitProgress(report ProgressReport) {
+	now := time.Now()
+	if report.Section == o.LastProgressReport.Section && report.Step == o.LastProgressReport.Step && now.Sub(o.LastProgressTime).Seconds() < 10 {
+		return
+	}
+	o.LastProgressReport = report
+	o.LastProgressTime = now
+	_, err := fmt.Fprintf(o.ErrStream, "[%s][%s] %.02f%%\n", report.Section, report.Step, report.Completeness*100)
+	if err != nil {
+		panic(err)
+	}
+}
+
+func (o *NdjsonOutput) ReportWorkloadProgress(completeness float64, checkpoint Result) {
+	_, err := fmt.Fprintf(o.ErrStream, "[workload] %.02f%% done, %s\n", completeness*100, o.failures.describe(plainNumbers{}, checkpoint))
+	if err != nil {
+		panic(err)
+	}
+}
+
+func (o *NdjsonOutput) ReportThroughput(result Result) {
+	o.writeRecords(result, "throughput")
+}
+
+func (o *NdjsonOutput) ReportLatency(result Result) {
+	o.writeRecords(result, "latency")
+}
+
+func (o *NdjsonOutput) writeRecords(result Result, mode string) {
+	database := result.DatabaseName
+	if database == "" {
+		database = "<default>"
+	}
+	timestamp := time.Now().UTC().Format(time.RFC3339)
+	enc := json.NewEncoder(o.OutStream)
+	for _, s := range result.SortedScripts() {
+		histo := s.Latencies
+		record := ndjsonRecord{
+			Timestamp:         timestamp,
+			Database:          database,
+			Scenario:          result.Scenario,
+			Mode:              mode,
+			Script:            s.ScriptName,
+			Succeeded:         s.Succeeded,
+			Failed:            s.Failed,
+			Rate:              s.Rate,
+			LatencySampleRate: result.LatencySampleRate,
+			MeanMs:            s.Millis(histo.Mean()),
+			StddevMs:          s.Millis(histo.StdDev()),
+			P0Ms:              s.Millis(float64(histo.Min())),
+			P25Ms:             s.Millis(float64(histo.ValueAtQuantile(25))),
+			P50Ms:             s.Millis(float64(histo.ValueAtQuantile(50))),
+			P75Ms:             s.Millis(float64(histo.ValueAtQuantile(75))),
+			P95Ms:             s.Millis(float64(histo.ValueAtQuantile(95))),
+			P99Ms:             s.Millis(float64(histo.ValueAtQuantile(99))),
+			P99999Ms:          s.Millis(float64(histo.ValueAtQuantile(99.999))),
+			P100Ms:            s.Millis(float64(histo.Max())),
+			ScheduleWaitP50Ms: quantileMillis(s, s.ScheduleWait, 50),
+			ScheduleWaitP99Ms: quantileMillis(s, s.ScheduleWait, 99),
+			ServiceP50Ms:      quantileMillis(s, s.ServiceTime, 50),
+			ServiceP99Ms:      quantileMillis(s, s.ServiceTime, 99),
+		}
+		if err := enc.Encode(record); err != nil {
+			panic(err)
+		}
+	}
+	flushStream(o.OutStream, true)
+
+	s := strings.Builder{}
+	writeNotExecutedNote(result, &s)
+	if result.TotalFailed() > 0 {
+		writeErrorReport(plainNumbers{}, result, &s)
+	}
+	if s.Len() > 0 {
+		if _, err := fmt.Fprint(o.ErrStream, s.String()); err != nil {
+			panic(err)
+		}
+	}
+}
+
+func (o *NdjsonOutput) Errorf(format string, a ...interface{}) {
+	_, err := fmt.Fprintf(o.ErrStream, "ERROR: %s\n", fmt.Sprintf(format, a...))
+	if err != nil {
+		panic(err)
+	}
+}
+
+func (o *NdjsonOutput) ReportPlan(scriptName, plan string) {
+	writePlan(o.ErrStream, scriptName, plan)
+}
+
+// The records of each workload already carry its scenario, so the summary is only for the person running it
+func (o *NdjsonOutput) ReportSuite(suite SuiteResult, latencyMode bool) {
+	writeSuiteReport(o.ErrStream, plainNumbers{}, suite, latencyMode)
+}
+
+var _ Output = &NdjsonOutput{}
@@ -0,0 +1,196 @@
+package neobench
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"github.com/pkg/errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Uploaders for the object storage URL schemes output files may be written to. Each copies a finished local
+// file to the given URL. They shell out to the vendor CLIs rather than linking the SDKs, which gets us the
+// standard credential chains (env vars, profiles, instance metadata) without pulling in either SDK.
+var objectStoreUploaders = map[string]func(localPath, url string) error{
+	"s3": func(localPath, url string) error {
+		return runUploadCommand("aws", "s3", "cp", "--only-show-errors", localPath, url)
+	},
+	"gs": func(localPath, url string) error {
+		return runUploadCommand("gsutil", "-q", "cp", localPath, url)
+	},
+}
+
+// The CLI each of objectStoreUploaders shells out to, checked for up front, see ValidateDestination
+var objectStoreCLIs = map[string]string{
+	"s3": "aws",
+	"gs": "gsutil",
+}
+
+// Replaced in tests, so they don't depend on what is installed
+var lookPath = exec.LookPath
+
+// Checks that results can be written to path, as far as can be told before writing them: for s3:// and gs://
+// URLs, that the scheme is supported and its CLI is on the PATH. Otherwise a missing CLI would only be
+// noticed when uploading, once the run is over.
+func ValidateDestination(path string) error {
+	scheme, isUrl := objectStoreScheme(path)
+	if !isUrl {
+		return nil
+	}
+	if _, ok := objectStoreUploaders[scheme]; !ok {
+		return fmt.Errorf("unsupported output url %s, expected a local path, s3:// or gs://", path)
+	}
+	if cli, ok := objectStoreCLIs[scheme]; ok {
+		if _, err := lookPath(cli); err != nil {
+			return errors.Wrapf(err, "uploading to %s needs the %s CLI installed and on the PATH", path, cli)
+		}
+	}
+	return nil
+}
+
+// Creates a file to write results to. If compress is set, or the path ends with .gz, the output is
+// gzip-compressed. Close must be called once writing is done, otherwise the compressed stream is truncated.
+// See CreateDestination for the paths that are accepted.
+func CreateOutputFile(path string, compress bool) (io.WriteCloser, error) {
+	f, err := CreateDestination(path)
+	if err != nil {
+		return nil, err
+	}
+	if !compress && !strings.HasSuffix(path, ".gz") {
+		return f, nil
+	}
+	return &gzipFile{Writer: gzip.NewWriter(f), f: f, path: path}, nil
+}
+
+// Creates a file to write to, either a local path or an s3:// or gs:// URL. Object storage destinations are
+// written to a local temporary file and uploaded when closed, so Close must be called and its error checked.
+func CreateDestination(path string) (io.WriteCloser, error) {
+	scheme, isUrl := objectStoreScheme(path)
+	if !isUrl {
+		f, err := os.Create(path)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to create output file %s", path)
+		}
+		return f, nil
+	}
+	if err := ValidateDestination(path); err != nil {
+		return nil, err
+	}
+	upload := objectStoreUploaders[scheme]
+	f, err := ioutil.TempFile("", "neobench-upload-")
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to create local buffer for %s", path)
+	}
+	return &uploadOnClose{File: f, url: path, upload: upload}, nil
+}
+
+// The scheme of path if it is a URL, as opposed to a local file path
+func objectStoreScheme(path string) (string, bool) {
+	i := strings.Index(path, "://")
+	if i <= 0 {
+		return "", false
+	}
+	return path[:i], true
+}
+
+type gzipFile struct {
+	*gzip.Writer
+	f    io.WriteCloser
+	path string
+}
+
+func (g *gzipFile) Close() error {
+	if err := g.Writer.Close(); err != nil {
+		_ = g.f.Close()
+		return errors.Wrapf(err, "failed to finish compressing %s", g.path)
+	}
+	return g.f.Close()
+}
+
+// Buffers output in a local file and uploads it to object storage on Close. If the upload fails, the local
+// file is left in place, so the results of a long run are not lost to a credentials problem.
+type uploadOnClose struct {
+	*os.File
+	url    string
+	upload func(localPath, url string) error
+}
+
+func (u *uploadOnClose) Close() error {
+	if err := u.File.Close(); err != nil {
+		return errors.Wrapf(err, "failed to write local buffer for %s", u.url)
+	}
+	if err := u.upload(u.File.Name(), u.url); err != nil {
+		return errors.Wrapf(err, "failed to upload to %s, output kept at %s", u.url, u.File.Name())
+	}
+	return os.Remove(u.File.Name())
+}
+
+func runUploadCommand(name string, args ...string) error {
+	cmd := exec.Command(name, args...)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return errors.Wrapf(err, "%s: %s", name, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// Buffers writes to the results stream, see --flush-interval. Outputs flush it after each progress report, at
+// most once per interval, and whenever they have written a final result, so a consumer reading the stream live
+// sees each line promptly; without this, a gzip-compressed --output-file would hold lines back until the run
+// ended. Close flushes, but leaves the underlying stream open for whoever opened it to close.
+type BufferedStream struct {
+	buf       *bufio.Writer
+	out       io.Writer
+	interval  time.Duration
+	lastFlush time.Time
+	now       func() time.Time
+}
+
+// An interval of zero flushes after every progress report
+func NewBufferedStream(out io.Writer, interval time.Duration) *BufferedStream {
+	return &BufferedStream{buf: bufio.NewWriter(out), out: out, interval: interval, now: time.Now}
+}
+
+func (s *BufferedStream) Write(p []byte) (int, error) {
+	return s.buf.Write(p)
+}
+
+// Writes out everything buffered, including anything held back by compression
+func (s *BufferedStream) Flush() error {
+	s.lastFlush = s.now()
+	if err := s.buf.Flush(); err != nil {
+		return err
+	}
+	if f, ok := s.out.(interface{ Flush() error }); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+func (s *BufferedStream) Close() error {
+	return s.Flush()
+}
+
+// Outputs call this once they're done writing a progress report, or, with final set, a result
+func flushStream(w io.Writer, final bool) {
+	s, ok := w.(*BufferedStream)
+	if !ok || (!final && s.now().Sub(s.lastFlush) < s.interval) {
+		return
+	}
+	if err := s.Flush(); err != nil {
+		panic(err)
+	}
+}
+
+// The stream a BufferedStream writes to, or w itself
+func unbuffered(w io.Writer) io.Writer {
+	if s, ok := w.(*BufferedStream); ok {
+		return s.out
+	}
+	return w
+}
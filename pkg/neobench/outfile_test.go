@@ -0,0 +1,163 @@
+package neobench
+
+import (
+	"bytes"
+	"compress/gzip"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCreateOutputFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "neobench-outfile")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	tests := map[string]struct {
+		compress      bool
+		expectGzipped bool
+	}{
+		"results.csv":    {expectGzipped: false},
+		"results.csv.gz": {expectGzipped: true},
+		"forced.csv":     {compress: true, expectGzipped: true},
+	}
+
+	for name, tc := range tests {
+		name, tc := name, tc
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(dir, name)
+			f, err := CreateOutputFile(path, tc.compress)
+			assert.NoError(t, err)
+			_, err = f.Write([]byte("db,script\n"))
+			assert.NoError(t, err)
+			assert.NoError(t, f.Close())
+
+			raw, err := os.Open(path)
+			assert.NoError(t, err)
+			defer raw.Close()
+			if !tc.expectGzipped {
+				content, err := ioutil.ReadAll(raw)
+				assert.NoError(t, err)
+				assert.Equal(t, "db,script\n", string(content))
+				return
+			}
+			gz, err := gzip.NewReader(raw)
+			assert.NoError(t, err)
+			content, err := ioutil.ReadAll(gz)
+			assert.NoError(t, err)
+			assert.Equal(t, "db,script\n", string(content))
+		})
+	}
+}
+
+func TestCreateOutputFileUploadsOnClose(t *testing.T) {
+	var uploadedTo string
+	var uploaded []byte
+	original, originalLookPath := objectStoreUploaders["s3"], lookPath
+	defer func() { objectStoreUploaders["s3"], lookPath = original, originalLookPath }()
+	lookPath = func(file string) (string, error) { return "/usr/bin/" + file, nil }
+	objectStoreUploaders["s3"] = func(localPath, url string) error {
+		uploadedTo = url
+		var err error
+		uploaded, err = ioutil.ReadFile(localPath)
+		return err
+	}
+
+	f, err := CreateOutputFile("s3://bucket/run-1/results.csv", false)
+	assert.NoError(t, err)
+	_, err = f.Write([]byte("db,script\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, "", uploadedTo)
+	assert.NoError(t, f.Close())
+
+	assert.Equal(t, "s3://bucket/run-1/results.csv", uploadedTo)
+	assert.Equal(t, "db,script\n", string(uploaded))
+
+	_, err = CreateOutputFile("ftp://host/results.csv", false)
+	assert.Error(t, err)
+}
+
+func TestValidateDestination(t *testing.T) {
+	originalLookPath := lookPath
+	defer func() { lookPath = originalLookPath }()
+	lookPath = func(file string) (string, error) {
+		if file == "gsutil" {
+			return "/usr/bin/gsutil", nil
+		}
+		return "", exec.ErrNotFound
+	}
+
+	tests := map[string]struct {
+		path        string
+		expectError string
+	}{
+		"local path":         {path: "results.csv"},
+		"cli installed":      {path: "gs://bucket/results.csv"},
+		"cli not installed":  {path: "s3://bucket/results.csv", expectError: "needs the aws CLI"},
+		"unsupported scheme": {path: "ftp://host/results.csv", expectError: "unsupported output url"},
+	}
+	for name, tc := range tests {
+		name, tc := name, tc
+		t.Run(name, func(t *testing.T) {
+			err := ValidateDestination(tc.path)
+			if tc.expectError == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), tc.expectError)
+			}
+		})
+	}
+}
+
+func TestBufferedStreamFlushesProgressAtCadence(t *testing.T) {
+	tests := map[string]struct {
+		interval      time.Duration
+		expectFlushed []string
+	}{
+		"after every progress report": {interval: 0, expectFlushed: []string{"a\n", "a\nb\n", "a\nb\nc\n"}},
+		"at most once a minute":       {interval: time.Minute, expectFlushed: []string{"", "a\nb\n", "a\nb\nc\n"}},
+	}
+
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			clock := &fakeSpaceTimeContinuum{currentTime: time.Date(2020, 1, 1, 1, 1, 1, 1, time.UTC)}
+			under := &bytes.Buffer{}
+			stream := NewBufferedStream(under, tc.interval)
+			stream.now = clock.now
+			stream.lastFlush = clock.now()
+
+			flushed := make([]string, 0)
+			for _, line := range []string{"a\n", "b\n"} {
+				clock.sleep(40 * time.Second)
+				_, _ = stream.Write([]byte(line))
+				flushStream(stream, false)
+				flushed = append(flushed, under.String())
+			}
+			// Final results are flushed regardless of the cadence
+			_, _ = stream.Write([]byte("c\n"))
+			flushStream(stream, true)
+			flushed = append(flushed, under.String())
+
+			assert.Equal(t, tc.expectFlushed, flushed)
+		})
+	}
+}
+
+func TestBufferedStreamFlushesThroughCompression(t *testing.T) {
+	under := &bytes.Buffer{}
+	stream := NewBufferedStream(&gzipFile{Writer: gzip.NewWriter(under)}, 0)
+	_, _ = stream.Write([]byte("db,script\n"))
+	assert.NoError(t, stream.Flush())
+
+	r, err := gzip.NewReader(bytes.NewReader(under.Bytes()))
+	assert.NoError(t, err)
+	content, err := ioutil.ReadAll(r)
+	assert.Equal(t, "db,script\n", string(content))
+	assert.Error(t, err, "the stream is not finished, just flushed")
+}
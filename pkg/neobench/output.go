@@ -5,12 +5,18 @@ import (
 	"github.com/codahale/hdrhistogram"
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"golang.org/x/text/message"
 	"io"
+	"math"
 	"net/http"
 	"os"
+	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -25,16 +31,35 @@ type Result struct {
 	DatabaseName string
 	Scenario     string
 
+	// Fraction of successful transactions whose latency was recorded, see --latency-sample-rate; 1 means all
+	// of them. Percentiles are estimates from the sample when this is below 1, counts and rates are not.
+	LatencySampleRate float64
+
 	FailedByErrorGroup map[string]FailureGroup
 
+	// Number of transactions that had to wait for a free slot under --max-in-flight before starting
+	InFlightCapHits int64
+
+	// Length of the measurement window, set by ReconcileRates; zero if not known
+	Duration time.Duration
+
 	// Results by script
 	Scripts map[string]*ScriptResult
+
+	// Samples of the target's own metrics, see --server-metrics-url; in a progress checkpoint, the samples taken
+	// since the previous one. Empty unless enabled.
+	ServerMetrics []ServerMetrics
+
+	// Total transactions per second in each progress interval of the measurement, oldest first; see
+	// ThroughputStability. Empty in progress checkpoints.
+	IntervalRates []float64
 }
 
 func NewResult(databaseName, scenario string) Result {
 	return Result{
 		DatabaseName:       databaseName,
 		Scenario:           scenario,
+		LatencySampleRate:  1,
 		FailedByErrorGroup: make(map[string]FailureGroup),
 		Scripts:            make(map[string]*ScriptResult),
 	}
@@ -54,29 +79,151 @@ func (r *Result) TotalFailed() (n int64) {
 	return
 }
 
+// Transactions per second, succeeded and failed, over the measurement window. If Duration is not known, this
+// falls back to summing the script rates, which were computed per worker over slightly different windows.
 func (r *Result) TotalRate() (n float64) {
+	if r.Duration > 0 {
+		return float64(r.TotalSucceeded()+r.TotalFailed()) / r.Duration.Seconds()
+	}
 	for _, s := range r.Scripts {
 		n += s.Rate
 	}
 	return
 }
 
+// Sets the measurement window of this result, and recomputes the script rates over it. Workers each compute
+// rates over their own lifetime, which differ slightly as they start and stop at different times; summing those
+// drifts from the rate the database actually saw, so the combined result should be reconciled to one duration.
+func (r *Result) ReconcileRates(duration time.Duration) {
+	if duration <= 0 {
+		return
+	}
+	r.Duration = duration
+	for _, s := range r.Scripts {
+		s.Rate = float64(s.Succeeded+s.Failed) / duration.Seconds()
+	}
+}
+
+// Scripts sorted by name; outputs should iterate scripts in this order rather than over the Scripts map, so that
+// results from different runs can be diffed
+func (r *Result) SortedScripts() []*ScriptResult {
+	out := make([]*ScriptResult, 0, len(r.Scripts))
+	for _, s := range r.Scripts {
+		out = append(out, s)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].ScriptName < out[j].ScriptName
+	})
+	return out
+}
+
+// Names of the error groups in FailedByErrorGroup, sorted
+func (r *Result) SortedErrorGroups() []string {
+	out := make([]string, 0, len(r.FailedByErrorGroup))
+	for name := range r.FailedByErrorGroup {
+		out = append(out, name)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// The fraction of all transactions, and of all time spent in successful transactions, that went to the given
+// script. With mixed scripts, this shows which script dominates the load, regardless of its weight in the mix.
+func (r *Result) Share(script *ScriptResult) (transactions, timeSpent float64) {
+	var totalTransactions int64
+	var totalTime time.Duration
+	for _, s := range r.Scripts {
+		totalTransactions += s.Succeeded + s.Failed
+		totalTime += s.TimeSpent()
+	}
+	if totalTransactions > 0 {
+		transactions = float64(script.Succeeded+script.Failed) / float64(totalTransactions)
+	}
+	if totalTime > 0 {
+		timeSpent = float64(script.TimeSpent()) / float64(totalTime)
+	}
+	return
+}
+
+// Adds an empty result for each of the named scripts that has none, so that a script that never ran, eg. because
+// its weight is tiny compared to the others, is reported as not executed rather than silently left out
+func (r *Result) IncludeScripts(names []string, resolution time.Duration) {
+	for _, name := range names {
+		if r.Scripts[name] != nil {
+			continue
+		}
+		r.Scripts[name] = &ScriptResult{
+			ScriptName: name,
+			Latencies:  newLatencyHistogram(resolution),
+			Resolution: resolution,
+		}
+	}
+}
+
+// Names of scripts that did not run a single transaction, sorted
+func (r *Result) NotExecuted() []string {
+	out := make([]string, 0)
+	for _, s := range r.SortedScripts() {
+		if !s.Executed() {
+			out = append(out, s.ScriptName)
+		}
+	}
+	return out
+}
+
+// Deep copy of this result, so that it can be handed to code that might modify it without affecting
+// anyone else holding the original
+func (r *Result) Copy() Result {
+	out := NewResult(r.DatabaseName, r.Scenario)
+	out.LatencySampleRate = r.LatencySampleRate
+	out.InFlightCapHits = r.InFlightCapHits
+	out.Duration = r.Duration
+	for name, group := range r.FailedByErrorGroup {
+		out.FailedByErrorGroup[name] = group
+	}
+	for name, script := range r.Scripts {
+		out.Scripts[name] = script.Copy()
+	}
+	for _, sample := range r.ServerMetrics {
+		values := make(map[string]float64, len(sample.Values))
+		for name, value := range sample.Values {
+			values[name] = value
+		}
+		out.ServerMetrics = append(out.ServerMetrics, ServerMetrics{Time: sample.Time, Values: values})
+	}
+	out.IntervalRates = append(out.IntervalRates, r.IntervalRates...)
+	return out
+}
+
 func (r *Result) Add(res WorkerResult) {
+	r.LatencySampleRate = res.LatencySampleRate
+	r.InFlightCapHits += res.InFlightCapHits
 	for _, workerScriptResult := range res.Scripts {
 		combinedScriptResult := r.Scripts[workerScriptResult.ScriptName]
 		if combinedScriptResult == nil {
 			r.Scripts[workerScriptResult.ScriptName] = &ScriptResult{
-				ScriptName: workerScriptResult.ScriptName,
-				Latencies:  hdrhistogram.Import(workerScriptResult.Latencies.Export()),
-				Rate:       workerScriptResult.Rate,
-				Succeeded:  workerScriptResult.Succeeded,
-				Failed:     workerScriptResult.Failed,
+				ScriptName:   workerScriptResult.ScriptName,
+				Latencies:    hdrhistogram.Import(workerScriptResult.Latencies.Export()),
+				Rate:         workerScriptResult.Rate,
+				Succeeded:    workerScriptResult.Succeeded,
+				Failed:       workerScriptResult.Failed,
+				Phases:       mergePhases(nil, workerScriptResult.Phases),
+				Resolution:   workerScriptResult.Resolution,
+				Checksums:    mergeChecksums(nil, workerScriptResult.Checksums),
+				ScheduleWait: mergeHistogram(nil, workerScriptResult.ScheduleWait),
+				ServiceTime:  mergeHistogram(nil, workerScriptResult.ServiceTime),
+				Updates:      workerScriptResult.Updates,
 			}
 		} else {
 			combinedScriptResult.Rate += workerScriptResult.Rate
 			combinedScriptResult.Succeeded += workerScriptResult.Succeeded
 			combinedScriptResult.Failed += workerScriptResult.Failed
 			combinedScriptResult.Latencies.Merge(workerScriptResult.Latencies)
+			combinedScriptResult.Phases = mergePhases(combinedScriptResult.Phases, workerScriptResult.Phases)
+			combinedScriptResult.Checksums = mergeChecksums(combinedScriptResult.Checksums, workerScriptResult.Checksums)
+			combinedScriptResult.ScheduleWait = mergeHistogram(combinedScriptResult.ScheduleWait, workerScriptResult.ScheduleWait)
+			combinedScriptResult.ServiceTime = mergeHistogram(combinedScriptResult.ServiceTime, workerScriptResult.ServiceTime)
+			combinedScriptResult.Updates.add(workerScriptResult.Updates)
 		}
 	}
 	for name, group := range res.FailedByErrorGroup {
@@ -103,10 +250,99 @@ type ScriptResult struct {
 	Failed    int64
 	Succeeded int64
 	Latencies *hdrhistogram.Histogram
+	// Latencies of each of the transaction Phases, by phase name; nil unless --latency-breakdown is set
+	Phases map[string]*hdrhistogram.Histogram
+	// Unit of the values in Latencies and Phases; use Millis to convert them. Zero means DefaultLatencyResolution.
+	Resolution time.Duration
+	// Number of successful transactions by checksum of the rows they returned; nil unless --checksum-results is set
+	Checksums map[string]int64
+	// In latency mode, Latencies are measured from when a transaction was scheduled to start. These split that
+	// into the time from schedule to dispatch, when the client was running behind, and the time from dispatch
+	// to completion. Both are nil in throughput mode, where there is no schedule.
+	ScheduleWait *hdrhistogram.Histogram
+	ServiceTime  *hdrhistogram.Histogram
+	// Data changed by the successful transactions
+	Updates UpdateCounts
+}
+
+// Latencies are recorded in microseconds, unless configured otherwise with --latency-resolution
+const DefaultLatencyResolution = time.Microsecond
+
+func newLatencyHistogram(resolution time.Duration) *hdrhistogram.Histogram {
+	return hdrhistogram.New(0, int64(time.Hour/resolution), 3)
+}
+
+// Converts a value from the Latencies or Phases histograms to milliseconds
+func (s *ScriptResult) Millis(value float64) float64 {
+	resolution := s.Resolution
+	if resolution == 0 {
+		resolution = DefaultLatencyResolution
+	}
+	return value * float64(resolution) / float64(time.Millisecond)
+}
+
+// Estimate of the total time spent in successful transactions of this script, from the mean latency; we don't
+// record latencies of failed transactions, so those are not included
+func (s *ScriptResult) TimeSpent() time.Duration {
+	return time.Duration(s.Millis(s.Latencies.Mean()*float64(s.Succeeded)) * float64(time.Millisecond))
+}
+
+// False if the script didn't run a single transaction, successful or not
+func (s *ScriptResult) Executed() bool {
+	return s.Succeeded+s.Failed > 0
+}
+
+func (s *ScriptResult) recordScheduleWait(latency, scheduleWait time.Duration) error {
+	if s.ScheduleWait == nil {
+		s.ScheduleWait = newLatencyHistogram(s.Resolution)
+		s.ServiceTime = newLatencyHistogram(s.Resolution)
+	}
+	if err := s.ScheduleWait.RecordValue(int64(scheduleWait / s.Resolution)); err != nil {
+		return errors.Wrapf(err, "failed to record schedule wait: %s", scheduleWait)
+	}
+	if err := s.ServiceTime.RecordValue(int64((latency - scheduleWait) / s.Resolution)); err != nil {
+		return errors.Wrapf(err, "failed to record service time: %s", latency-scheduleWait)
+	}
+	return nil
+}
+
+// Merges src into dst, returning dst; if dst is nil, returns a copy of src
+func mergeHistogram(dst, src *hdrhistogram.Histogram) *hdrhistogram.Histogram {
+	if src == nil {
+		return dst
+	}
+	if dst == nil {
+		return hdrhistogram.Import(src.Export())
+	}
+	dst.Merge(src)
+	return dst
+}
+
+func (s *ScriptResult) Copy() *ScriptResult {
+	return &ScriptResult{
+		ScriptName:   s.ScriptName,
+		Rate:         s.Rate,
+		Failed:       s.Failed,
+		Succeeded:    s.Succeeded,
+		Latencies:    hdrhistogram.Import(s.Latencies.Export()),
+		Phases:       mergePhases(nil, s.Phases),
+		Resolution:   s.Resolution,
+		Checksums:    mergeChecksums(nil, s.Checksums),
+		ScheduleWait: mergeHistogram(nil, s.ScheduleWait),
+		ServiceTime:  mergeHistogram(nil, s.ServiceTime),
+		Updates:      s.Updates,
+	}
 }
 
+// Outputs must treat the Results they are given as read-only; the same Result may be handed to several outputs,
+// and the runner may keep using it after the output returns. If an output needs derived state, like latencies
+// rescaled to some other unit, it should compute that into its own structures rather than modify the Result.
+//
+// Outputs that hold results back, to write everything a process reports as one document, also implement
+// io.Closer, and write what they held back when closed; close them once the last result has been reported.
 type Output interface {
-	// scenario is a string describing the flags you'd need to pass to neobench to run an equivalent load
+	// scenario is a string describing the flags you'd need to pass to neobench to run an equivalent load. Called
+	// once per process, before the first benchmark; --sequential and suites run several, each reported on its own
 	BenchmarkStart(databaseName, url, scenario string)
 	// Called if running in --init mode, eg. we are doing dataset population for one of the built-in workloads
 	ReportInitProgress(report ProgressReport)
@@ -120,38 +356,137 @@ type Output interface {
 	Errorf(format string, a ...interface{})
 }
 
-// Creates the output specified by name; if prometheusAddress is set, also starts
+type OutputOptions struct {
+	// Where to write results to
+	OutStream io.Writer
+	// Where to write progress and errors to; os.Stderr if not set
+	ErrStream io.Writer
+	// If set, also publish metrics to prometheus at this address
+	PrometheusAddress string
+	// Prefix CSV output with comment lines describing the run, see CsvOutput.WriteMetadata
+	CsvMetadata bool
+	// Columns to write in CSV output, in order, see CsvOutput.Columns
+	CsvColumns []string
+	// Latency quantiles to report in json output, see JsonOutput.Quantiles
+	JsonQuantiles []float64
+	// neobench version, for outputs that record it
+	Version string
+	// Locale to format numbers in, in interactive output, see LocalePrinter; from the environment if empty
+	Locale string
+}
+
+// Creates an output from the options passed to InitOutput
+type OutputFactory func(opts OutputOptions) (Output, error)
+
+var (
+	outputsMut sync.Mutex
+	outputs    = make(map[string]OutputFactory)
+)
+
+func init() {
+	RegisterOutput("interactive", func(opts OutputOptions) (Output, error) {
+		printer, err := LocalePrinter(opts.Locale, os.LookupEnv)
+		if err != nil {
+			return nil, err
+		}
+		return &InteractiveOutput{ErrStream: opts.ErrStream, OutStream: opts.OutStream, Printer: printer}, nil
+	})
+	RegisterOutput("csv", func(opts OutputOptions) (Output, error) {
+		if err := ValidateCsvColumns(opts.CsvColumns); err != nil {
+			return nil, err
+		}
+		return &CsvOutput{
+			ErrStream:     opts.ErrStream,
+			OutStream:     opts.OutStream,
+			WriteMetadata: opts.CsvMetadata,
+			Version:       opts.Version,
+			Columns:       opts.CsvColumns,
+		}, nil
+	})
+	RegisterOutput("ndjson", func(opts OutputOptions) (Output, error) {
+		return &NdjsonOutput{ErrStream: opts.ErrStream, OutStream: opts.OutStream}, nil
+	})
+	RegisterOutput("json", func(opts OutputOptions) (Output, error) {
+		if err := ValidateJsonQuantiles(opts.JsonQuantiles); err != nil {
+			return nil, err
+		}
+		return &JsonOutput{
+			ErrStream: opts.ErrStream,
+			OutStream: opts.OutStream,
+			Quantiles: opts.JsonQuantiles,
+			Version:   opts.Version,
+		}, nil
+	})
+	RegisterOutput("html", func(opts OutputOptions) (Output, error) {
+		return &HtmlOutput{ErrStream: opts.ErrStream, OutStream: opts.OutStream}, nil
+	})
+}
+
+// Makes an output format available to InitOutput, and so to --output, under the given name. This is meant to
+// be called from the init() of a package adding its own format, in a build of neobench that imports it.
+// Like database/sql.Register, it panics if the name is already taken, since that is a programming error.
+func RegisterOutput(name string, factory func(opts OutputOptions) (Output, error)) {
+	outputsMut.Lock()
+	defer outputsMut.Unlock()
+	if factory == nil {
+		panic("neobench: RegisterOutput factory is nil")
+	}
+	if name == "auto" {
+		panic("neobench: output name auto is reserved")
+	}
+	if _, taken := outputs[name]; taken {
+		panic(fmt.Sprintf("neobench: RegisterOutput called twice for output %s", name))
+	}
+	outputs[name] = factory
+}
+
+// Lists the registered output names, for error messages
+func describeOutputs() string {
+	outputsMut.Lock()
+	defer outputsMut.Unlock()
+	names := make([]string, 0, len(outputs))
+	for name := range outputs {
+		names = append(names, fmt.Sprintf("'%s'", name))
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// Creates the output registered under name, see RegisterOutput; if opts.PrometheusAddress is set, also starts
 // that as an output, returning an output that publishes to both
 // TODO(jake): Maybe this would be nicer with `name` a comma-separated list, eg. csv,prometheus
-func InitOutput(name, prometheusAddress string) (Output, error) {
+func InitOutput(name string, opts OutputOptions) (Output, error) {
+	outStream := opts.OutStream
 	if name == "auto" {
-		fi, _ := os.Stdout.Stat()
-		if fi.Mode()&os.ModeCharDevice == 0 {
-			name = "csv"
-		} else {
-			name = "interactive"
+		name = "csv"
+		if unbuffered(outStream) == os.Stdout {
+			fi, _ := os.Stdout.Stat()
+			if fi.Mode()&os.ModeCharDevice != 0 {
+				name = "interactive"
+			}
 		}
 	}
 
-	var output Output
-	if name == "interactive" {
-		output = &InteractiveOutput{
-			ErrStream: os.Stderr,
-			OutStream: os.Stdout,
-		}
-	} else if name == "csv" {
-		output = &CsvOutput{
-			ErrStream: os.Stderr,
-			OutStream: os.Stdout,
-		}
-	} else {
-		return nil, fmt.Errorf("unknown output format: %s, supported formats are 'auto', 'interactive' and 'csv'", name)
+	if opts.ErrStream == nil {
+		opts.ErrStream = os.Stderr
+	}
+
+	outputsMut.Lock()
+	factory, found := outputs[name]
+	outputsMut.Unlock()
+	if !found {
+		return nil, fmt.Errorf("unknown output format: %s, supported formats are 'auto', %s", name, describeOutputs())
+	}
+	output, err := factory(opts)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to create %s output", name)
 	}
 
-	if prometheusAddress != "" {
-		InitPrometheus(prometheusAddress)
+	if opts.PrometheusAddress != "" {
+		prometheusOutput := NewPrometheusOutput()
+		InitPrometheus(opts.PrometheusAddress, prometheusOutput)
 		output = &CombinedOutput{
-			delegates: []Output{output, NewPrometheusOutput()},
+			delegates: []Output{output, prometheusOutput},
 		}
 	}
 
@@ -164,9 +499,21 @@ type InteractiveOutput struct {
 	// Used to rate-limit progress reporting
 	LastProgressReport ProgressReport
 	LastProgressTime   time.Time
+	failures           failureTally
+	// Formats numbers per locale, see --locale; nil for plain formatting
+	Printer *message.Printer
+}
+
+// Interactive output is for people to read, so unlike the other outputs, it formats numbers per locale
+func (o *InteractiveOutput) numbers() numberFormat {
+	if o.Printer == nil {
+		return plainNumbers{}
+	}
+	return localeNumbers{printer: o.Printer}
 }
 
 func (o *InteractiveOutput) BenchmarkStart(databaseName, url, scenario string) {
+	o.failures.reset()
 	if databaseName == "" {
 		databaseName = "<default>"
 	}
@@ -179,7 +526,8 @@ func (o *InteractiveOutput) BenchmarkStart(databaseName, url, scenario string) {
 }
 
 func (o *InteractiveOutput) ReportWorkloadProgress(completeness float64, checkpoint Result) {
-	_, err := fmt.Fprintf(o.ErrStream, "[%.02f%%] %.02f tps / %d failures\n", completeness*100, checkpoint.TotalRate(), checkpoint.TotalFailed())
+	p := o.numbers()
+	_, err := fmt.Fprint(o.ErrStream, p.Sprintf("[%.02f%%] %.02f tps / %s\n", completeness*100, checkpoint.TotalRate(), o.failures.describe(p, checkpoint)))
 	if err != nil {
 		panic(err)
 	}
@@ -199,80 +547,272 @@ func (o *InteractiveOutput) ReportInitProgress(report ProgressReport) {
 }
 
 func (o *InteractiveOutput) ReportThroughput(result Result) {
+	p := o.numbers()
 	s := strings.Builder{}
 
 	s.WriteString("== Results ==\n")
-	s.WriteString(fmt.Sprintf("Scenario: %s\n", result.Scenario))
-	s.WriteString(fmt.Sprintf("%d successful transactions, %d failed. (Total of %.3f per second)\n", result.TotalSucceeded(), result.TotalFailed(), result.TotalRate()))
+	s.WriteString(p.Sprintf("Scenario: %s\n", result.Scenario))
+	s.WriteString(p.Sprintf("%d successful transactions, %d failed. (Total of %.3f per second)\n", result.TotalSucceeded(), result.TotalFailed(), result.TotalRate()))
+	writeStabilityNote(p, result, &s)
+	writeSaturationNote(p, result, &s)
 	s.WriteString("\n")
-	for _, script := range result.Scripts {
-		s.WriteString(fmt.Sprintf("  [%s]: %.03f total transactions per second\n", script.ScriptName, script.Rate))
+	for _, script := range result.SortedScripts() {
+		if !script.Executed() {
+			s.WriteString(p.Sprintf("  [%s]: not executed\n", script.ScriptName))
+			continue
+		}
+		s.WriteString(p.Sprintf("  [%s]: %.03f total transactions per second", script.ScriptName, script.Rate))
+		if len(result.Scripts) > 1 {
+			s.WriteString(p.Sprintf(" (%s)", describeShare(p, result, script)))
+		}
+		s.WriteString("\n")
 	}
 	s.WriteString("\n")
-	writeErrorReport(result, &s)
+	writeNotExecutedNote(result, &s)
+	writeUpdatesReport(p, result, &s)
+	writeChecksumReport(result, &s)
+	writeServerMetricsReport(p, result, &s)
+	writeErrorReport(p, result, &s)
 
-	_, err := fmt.Fprintf(o.OutStream, s.String())
+	_, err := fmt.Fprint(o.OutStream, s.String())
 	if err != nil {
 		panic(err)
 	}
+	flushStream(o.OutStream, true)
 }
 
 func (o *InteractiveOutput) ReportLatency(result Result) {
+	p := o.numbers()
 	s := strings.Builder{}
 
 	s.WriteString("== Results ==\n")
 
-	s.WriteString(fmt.Sprintf("Scenario: %s\n", result.Scenario))
-	s.WriteString(fmt.Sprintf("%d successful transactions, %d failed. (Total of %.3f per second)\n", result.TotalSucceeded(), result.TotalFailed(), result.TotalRate()))
+	s.WriteString(p.Sprintf("Scenario: %s\n", result.Scenario))
+	s.WriteString(p.Sprintf("%d successful transactions, %d failed. (Total of %.3f per second)\n", result.TotalSucceeded(), result.TotalFailed(), result.TotalRate()))
+	writeSampleRateNote(p, result, &s)
+	writeStabilityNote(p, result, &s)
+	writeSaturationNote(p, result, &s)
 
 	if result.TotalSucceeded() > 0 {
-		for _, workload := range result.Scripts {
+		for _, workload := range result.SortedScripts() {
+			if !workload.Executed() {
+				continue
+			}
 			s.WriteString("\n")
-			s.WriteString(fmt.Sprintf("-- Script: %s --\n\n", workload.ScriptName))
-			summarizeLatency(workload, &s, "  ")
+			s.WriteString(p.Sprintf("-- Script: %s --\n\n", workload.ScriptName))
+			if len(result.Scripts) > 1 {
+				s.WriteString(p.Sprintf("  Share: %s\n", describeShare(p, result, workload)))
+			}
+			summarizeLatency(p, workload, &s, "  ")
 		}
 	}
 	s.WriteString("\n")
-	writeErrorReport(result, &s)
+	writeNotExecutedNote(result, &s)
+	writeChecksumReport(result, &s)
+	writeServerMetricsReport(p, result, &s)
+	writeErrorReport(p, result, &s)
 
 	_, err := fmt.Fprint(o.OutStream, s.String())
 	if err != nil {
 		panic(err)
 	}
+	flushStream(o.OutStream, true)
+}
+
+func describeShare(p numberFormat, result Result, script *ScriptResult) string {
+	transactions, timeSpent := result.Share(script)
+	return p.Sprintf("%.1f%% of transactions, %.1f%% of time spent", transactions*100, timeSpent*100)
 }
 
-func summarizeLatency(script *ScriptResult, s *strings.Builder, indent string) {
+func summarizeLatency(p numberFormat, script *ScriptResult, s *strings.Builder, indent string) {
 	histo := script.Latencies
 	lines := []string{
-		fmt.Sprintf("%d successful transactions, %d failed. (Total of %.3f per second)\n", script.Succeeded, script.Failed, script.Rate),
-		fmt.Sprintf("Max: %.3fms, Min: %.3fms, Mean: %.3fms, Stddev: %.3f\n\n",
-			float64(histo.Max())/1000.0, float64(histo.Min())/1000.0, histo.Mean()/1000.0, histo.StdDev()/1000.0),
-		fmt.Sprintf("Latency distribution:\n"),
-		fmt.Sprintf("  P00.000: %.03fms\n", float64(histo.Min())/1000.0),
-		fmt.Sprintf("  P25.000: %.03fms\n", float64(histo.ValueAtQuantile(25))/1000.0),
-		fmt.Sprintf("  P50.000: %.03fms\n", float64(histo.ValueAtQuantile(50))/1000.0),
-		fmt.Sprintf("  P75.000: %.03fms\n", float64(histo.ValueAtQuantile(75))/1000.0),
-		fmt.Sprintf("  P95.000: %.03fms\n", float64(histo.ValueAtQuantile(95))/1000.0),
-		fmt.Sprintf("  P99.000: %.03fms\n", float64(histo.ValueAtQuantile(99))/1000.0),
-		fmt.Sprintf("  P99.999: %.03fms\n", float64(histo.ValueAtQuantile(99.999))/1000.0),
+		p.Sprintf("%d successful transactions, %d failed. (Total of %.3f per second)\n", script.Succeeded, script.Failed, script.Rate),
+		p.Sprintf("Max: %.3fms, Min: %.3fms, Mean: %.3fms, Stddev: %.3f\n\n",
+			script.Millis(float64(histo.Max())), script.Millis(float64(histo.Min())), script.Millis(histo.Mean()), script.Millis(histo.StdDev())),
+		p.Sprintf("Latency distribution:\n"),
+		p.Sprintf("  P00.000: %.03fms\n", script.Millis(float64(histo.Min()))),
+		p.Sprintf("  P25.000: %.03fms\n", script.Millis(float64(histo.ValueAtQuantile(25)))),
+		p.Sprintf("  P50.000: %.03fms\n", script.Millis(float64(histo.ValueAtQuantile(50)))),
+		p.Sprintf("  P75.000: %.03fms\n", script.Millis(float64(histo.ValueAtQuantile(75)))),
+		p.Sprintf("  P95.000: %.03fms\n", script.Millis(float64(histo.ValueAtQuantile(95)))),
+		p.Sprintf("  P99.000: %.03fms\n", script.Millis(float64(histo.ValueAtQuantile(99)))),
+		p.Sprintf("  P99.999: %.03fms\n", script.Millis(float64(histo.ValueAtQuantile(99.999)))),
 	}
 	for _, line := range lines {
 		s.WriteString(indent)
 		s.WriteString(line)
 	}
+	if script.ScheduleWait != nil {
+		s.WriteString("\n")
+		summarizeScheduleWait(p, script, s, indent)
+	}
+	if script.Phases != nil {
+		s.WriteString("\n")
+		summarizePhases(p, script, s, indent)
+	}
+}
+
+// Splits latency, measured from when each transaction was scheduled to start, into time spent waiting to be
+// dispatched and time spent being served; a large schedule wait means the client fell behind the target rate
+func summarizeScheduleWait(p numberFormat, script *ScriptResult, s *strings.Builder, indent string) {
+	s.WriteString(indent)
+	s.WriteString("Latency is from scheduled start to completion, of which:\n")
+	for _, part := range []struct {
+		name  string
+		histo *hdrhistogram.Histogram
+	}{
+		{"Schedule wait (scheduled start to dispatch)", script.ScheduleWait},
+		{"Service time (dispatch to completion)", script.ServiceTime},
+	} {
+		s.WriteString(indent)
+		s.WriteString(p.Sprintf("  %s: Mean: %.3fms, P50: %.3fms, P99: %.3fms, Max: %.3fms\n", part.name,
+			script.Millis(part.histo.Mean()), script.Millis(float64(part.histo.ValueAtQuantile(50))),
+			script.Millis(float64(part.histo.ValueAtQuantile(99))), script.Millis(float64(part.histo.Max()))))
+	}
+}
+
+// Converts a quantile of one of the histograms of the script to milliseconds; 0 if the histogram is nil
+func quantileMillis(s *ScriptResult, histo *hdrhistogram.Histogram, quantile float64) float64 {
+	if histo == nil {
+		return 0
+	}
+	return s.Millis(float64(histo.ValueAtQuantile(quantile)))
+}
+
+// Writes where, on average, time went in the script's transactions, as a stacked bar. Phases with nothing
+// recorded, like begin and commit for autocommit transactions, are shown as not applicable.
+func summarizePhases(p numberFormat, script *ScriptResult, s *strings.Builder, indent string) {
+	total := 0.0
+	for _, phase := range Phases {
+		if histo, found := script.Phases[phase]; found && histo.TotalCount() > 0 {
+			total += histo.Mean()
+		}
+	}
+	s.WriteString(indent)
+	s.WriteString(p.Sprintf("Latency breakdown (mean per transaction, %.3fms total):\n", script.Millis(total)))
+	if total == 0 {
+		return
+	}
+	barWidth := 40
+	for _, phase := range Phases {
+		histo, found := script.Phases[phase]
+		if !found || histo.TotalCount() == 0 {
+			s.WriteString(indent)
+			s.WriteString(p.Sprintf("  %-10s %10s\n", phase+":", "n/a"))
+			continue
+		}
+		share := histo.Mean() / total
+		s.WriteString(indent)
+		s.WriteString(p.Sprintf("  %-10s %8.3fms %6.2f%% (p99: %.3fms) %s\n", phase+":", script.Millis(histo.Mean()), share*100,
+			script.Millis(float64(histo.ValueAtQuantile(99))), strings.Repeat("#", int(share*float64(barWidth)+0.5))))
+	}
+}
+
+func writeSampleRateNote(p numberFormat, result Result, s *strings.Builder) {
+	if result.LatencySampleRate >= 1 {
+		return
+	}
+	s.WriteString(p.Sprintf("Latencies recorded for a random %.3f%% sample of successful transactions; percentiles are estimates\n",
+		result.LatencySampleRate*100))
+}
+
+func writeNotExecutedNote(result Result, s *strings.Builder) {
+	names := result.NotExecuted()
+	if len(names) == 0 {
+		return
+	}
+	s.WriteString(fmt.Sprintf("Not executed, no transactions ran for: %s; check the script weights\n\n", strings.Join(names, ", ")))
+}
+
+func writeStabilityNote(p numberFormat, result Result, s *strings.Builder) {
+	stability, ok := result.ThroughputStability()
+	if !ok {
+		return
+	}
+	s.WriteString(p.Sprintf("Throughput varied by %.1f%% (coefficient of variation) over %d progress intervals: "+
+		"mean %.3f, standard deviation %.3f, min %.3f, max %.3f per second\n", stability.CoefficientOfVariation*100,
+		stability.Intervals, stability.Mean, stability.StdDev, stability.Min, stability.Max))
+}
+
+func writeSaturationNote(p numberFormat, result Result, s *strings.Builder) {
+	if result.InFlightCapHits == 0 {
+		return
+	}
+	total := result.TotalSucceeded() + result.TotalFailed()
+	s.WriteString(p.Sprintf("%d transactions (%.3f%%) waited for a free --max-in-flight slot before starting; the database is not keeping up\n",
+		result.InFlightCapHits, 100*float64(result.InFlightCapHits)/float64(total)))
+}
+
+// How many transactions of each script changed data, and how fast; failed transactions are rolled back, so they
+// never change anything
+func writeUpdatesReport(p numberFormat, result Result, s *strings.Builder) {
+	s.WriteString("Data changes:\n")
+	for _, script := range result.SortedScripts() {
+		if !script.Executed() {
+			continue
+		}
+		updates := script.Updates
+		s.WriteString(p.Sprintf("  [%s]: %d of %d successful transactions changed data (%.1f%%), %d failed and rolled back",
+			script.ScriptName, updates.Changed, script.Succeeded, 100*float64(updates.Changed)/math.Max(1, float64(script.Succeeded)), script.Failed))
+		if updates.any() && script.Rate > 0 {
+			// Rate covers failed transactions too, so this is the length of the measurement window
+			seconds := float64(script.Succeeded+script.Failed) / script.Rate
+			s.WriteString("; ")
+			s.WriteString(updates.describeRates(p, seconds))
+		}
+		s.WriteString("\n")
+	}
+	s.WriteString("\n")
+}
+
+func writeChecksumReport(result Result, s *strings.Builder) {
+	header := false
+	for _, script := range result.SortedScripts() {
+		if script.Checksums == nil {
+			continue
+		}
+		if !header {
+			s.WriteString("Result checksums:\n")
+			header = true
+		}
+		s.WriteString(fmt.Sprintf("  [%s]: %s\n", script.ScriptName, describeChecksums(script)))
+	}
+	if header {
+		s.WriteString("\n")
+	}
 }
 
-func writeErrorReport(result Result, s *strings.Builder) {
-	s.WriteString(fmt.Sprintf("Error stats:\n"))
+func writeServerMetricsReport(p numberFormat, result Result, s *strings.Builder) {
+	summary, ok := SummarizeServerMetrics(result.ServerMetrics)
+	if !ok {
+		return
+	}
+	s.WriteString(p.Sprintf("Server metrics (%d samples):\n", len(result.ServerMetrics)))
+	if summary.HasPageCache {
+		s.WriteString(p.Sprintf("  Page cache hit ratio: Mean: %.2f%%, Min: %.2f%%\n", summary.PageCacheHitRatioMean*100, summary.PageCacheHitRatioMin*100))
+	}
+	if summary.HasGcTime {
+		s.WriteString(p.Sprintf("  GC pauses: %.0fms in total, %.2f%% of the time\n", summary.GcTime.Seconds()*1000, summary.GcShare*100))
+	}
+	if summary.HasHeap {
+		s.WriteString(p.Sprintf("  Heap used: Max: %.1fMiB\n", summary.HeapUsedMax/(1<<20)))
+	}
+	s.WriteString("\n")
+}
+
+func writeErrorReport(p numberFormat, result Result, s *strings.Builder) {
+	s.WriteString(p.Sprintf("Error stats:\n"))
 	if result.TotalFailed() == 0 {
-		s.WriteString(fmt.Sprintf("  No errors!\n"))
+		s.WriteString(p.Sprintf("  No errors!\n"))
 	} else {
-		s.WriteString(fmt.Sprintf("  Failed transactions: %d (%.3f %%)\n", result.TotalFailed(), 100*float64(result.TotalFailed())/float64(result.TotalFailed()+result.TotalSucceeded())))
-		s.WriteString(fmt.Sprintf("\n"))
-		s.WriteString(fmt.Sprintf("  Causes:\n"))
-		for name, info := range result.FailedByErrorGroup {
-			s.WriteString(fmt.Sprintf("    %s: %d failures\n", name, info.Count))
-			s.WriteString(fmt.Sprintf("      (ex: %s)\n", info.FirstFailure))
+		s.WriteString(p.Sprintf("  Failed transactions: %d (%.3f %%)\n", result.TotalFailed(), 100*float64(result.TotalFailed())/float64(result.TotalFailed()+result.TotalSucceeded())))
+		s.WriteString(p.Sprintf("\n"))
+		s.WriteString(p.Sprintf("  Causes:\n"))
+		for _, name := range result.SortedErrorGroups() {
+			info := result.FailedByErrorGroup[name]
+			s.WriteString(p.Sprintf("    %s: %d failures\n", name, info.Count))
+			s.WriteString(p.Sprintf("      (ex: %s)\n", info.FirstFailure))
 		}
 	}
 }
@@ -284,17 +824,38 @@ func (o *InteractiveOutput) Errorf(format string, a ...interface{}) {
 	}
 }
 
+func (o *InteractiveOutput) ReportPlan(scriptName, plan string) {
+	writePlan(o.OutStream, scriptName, plan)
+	flushStream(o.OutStream, true)
+}
+
+func (o *InteractiveOutput) ReportSuite(suite SuiteResult, latencyMode bool) {
+	writeSuiteReport(o.OutStream, o.numbers(), suite, latencyMode)
+	flushStream(o.OutStream, true)
+}
+
 // Writes simple progress to stderr, and then a result for easy import into eg. a spreadsheet or other app
 // in CSV format to stdout
 type CsvOutput struct {
 	ErrStream io.Writer
 	OutStream io.Writer
+	// If set, BenchmarkStart writes the neobench version, start time, target and scenario as comment lines
+	// starting with #, before the header row. Off by default since strict CSV parsers reject comments.
+	WriteMetadata bool
+	Version       string
+	// Names of the columns to write, in order; all of them, in their default order, if empty. See
+	// ValidateCsvColumns for the known names.
+	Columns []string
 	// Used to rate-limit progress reporting
 	LastProgressReport ProgressReport
 	LastProgressTime   time.Time
+	failures           failureTally
+	// The throughput table has its own header, written once, before the first throughput result
+	wroteThroughputHeader bool
 }
 
 func (o *CsvOutput) BenchmarkStart(databaseName, url, scenario string) {
+	o.failures.reset()
 	if databaseName == "" {
 		databaseName = "<default>"
 	}
@@ -305,14 +866,33 @@ func (o *CsvOutput) BenchmarkStart(databaseName, url, scenario string) {
 		panic(err)
 	}
 
-	columnNames := make([]string, 0, len(csvColumns))
-	for _, col := range csvColumns {
+	if o.WriteMetadata {
+		metadata := []string{
+			fmt.Sprintf("neobench version: %s", o.Version),
+			fmt.Sprintf("started: %s", time.Now().UTC().Format(time.RFC3339)),
+			fmt.Sprintf("url: %s", RedactUrl(url)),
+			fmt.Sprintf("database: %s", databaseName),
+			fmt.Sprintf("scenario: neobench%s", scenario),
+		}
+		for _, line := range metadata {
+			// Newlines would end the comment, and the rest of the line would be read as a row
+			line = strings.NewReplacer("\r", " ", "\n", " ").Replace(line)
+			if _, err := fmt.Fprintf(o.OutStream, "# %s\n", line); err != nil {
+				panic(err)
+			}
+		}
+	}
+
+	columns := o.columns()
+	columnNames := make([]string, 0, len(columns))
+	for _, col := range columns {
 		columnNames = append(columnNames, col.name)
 	}
 	_, err = fmt.Fprintf(o.OutStream, "%s\n", strings.Join(columnNames, ","))
 	if err != nil {
 		panic(err)
 	}
+	flushStream(o.OutStream, false)
 }
 
 func (o *CsvOutput) ReportInitProgress(report ProgressReport) {
@@ -329,11 +909,12 @@ func (o *CsvOutput) ReportInitProgress(report ProgressReport) {
 }
 
 func (o *CsvOutput) ReportWorkloadProgress(completeness float64, checkpoint Result) {
-	_, err := fmt.Fprintf(o.ErrStream, "[workload] %.02f%% done\n", completeness*100)
+	_, err := fmt.Fprintf(o.ErrStream, "[workload] %.02f%% done, %s\n", completeness*100, o.failures.describe(plainNumbers{}, checkpoint))
 	if err != nil {
 		panic(err)
 	}
-	o.ReportLatency(checkpoint)
+	o.writeLatencyReport(checkpoint)
+	flushStream(o.OutStream, false)
 }
 
 func (o *CsvOutput) ReportThroughput(result Result) {
@@ -341,10 +922,13 @@ func (o *CsvOutput) ReportThroughput(result Result) {
 
 	s := strings.Builder{}
 	separator := ","
-	s.WriteString(strings.Join(columns, separator))
-	s.WriteString("\n")
+	if !o.wroteThroughputHeader {
+		s.WriteString(strings.Join(columns, separator))
+		s.WriteString("\n")
+		o.wroteThroughputHeader = true
+	}
 
-	for _, script := range result.Scripts {
+	for _, script := range result.SortedScripts() {
 		row := []float64{
 			float64(script.Succeeded),
 			float64(script.Failed),
@@ -363,10 +947,19 @@ func (o *CsvOutput) ReportThroughput(result Result) {
 	if _, err := fmt.Fprint(o.OutStream, s.String()); err != nil {
 		panic(err)
 	}
+	flushStream(o.OutStream, true)
+
+	s.Reset()
+	writeNotExecutedNote(result, &s)
+	writeSaturationNote(plainNumbers{}, result, &s)
+	writeChecksumReport(result, &s)
+	if _, err := fmt.Fprint(o.ErrStream, s.String()); err != nil {
+		panic(err)
+	}
 
 	if result.TotalFailed() > 0 {
 		s.Reset()
-		writeErrorReport(result, &s)
+		writeErrorReport(plainNumbers{}, result, &s)
 		if _, err := fmt.Fprint(o.ErrStream, s.String()); err != nil {
 			panic(err)
 		}
@@ -374,14 +967,28 @@ func (o *CsvOutput) ReportThroughput(result Result) {
 }
 
 func (o *CsvOutput) ReportLatency(result Result) {
+	o.writeLatencyReport(result)
+	flushStream(o.OutStream, true)
+}
+
+func (o *CsvOutput) writeLatencyReport(result Result) {
 	o.writeLatencyRow(result)
+	// Goes to stderr to keep stdout strictly CSV
+	s := strings.Builder{}
+	writeNotExecutedNote(result, &s)
+	writeSampleRateNote(plainNumbers{}, result, &s)
+	writeSaturationNote(plainNumbers{}, result, &s)
+	writeChecksumReport(result, &s)
+	if _, err := fmt.Fprint(o.ErrStream, s.String()); err != nil {
+		panic(err)
+	}
 }
 
 func (o *CsvOutput) writeLatencyRow(result Result) {
 	s := strings.Builder{}
 
-	for _, script := range result.Scripts {
-		for i, col := range csvColumns {
+	for _, script := range result.SortedScripts() {
+		for i, col := range o.columns() {
 			if i != 0 {
 				s.WriteString(",")
 			}
@@ -397,7 +1004,7 @@ func (o *CsvOutput) writeLatencyRow(result Result) {
 
 	if result.TotalFailed() > 0 {
 		s.Reset()
-		writeErrorReport(result, &s)
+		writeErrorReport(plainNumbers{}, result, &s)
 		if _, err := fmt.Fprint(o.ErrStream, s.String()); err != nil {
 			panic(err)
 		}
@@ -414,34 +1021,84 @@ func fmtFloat(v interface{}) string {
 	return fmt.Sprintf("%v?", v)
 }
 
-var csvColumns = []struct {
+type csvColumn struct {
 	name  string
 	value func(r Result, s *ScriptResult) string
-}{
+}
+
+// Checks that all the given column names are known CSV columns, and that none is repeated
+func ValidateCsvColumns(names []string) error {
+	seen := make(map[string]bool, len(names))
+	for _, name := range names {
+		if _, found := findCsvColumn(name); !found {
+			known := make([]string, 0, len(csvColumns))
+			for _, col := range csvColumns {
+				known = append(known, col.name)
+			}
+			return fmt.Errorf("unknown csv column '%s', known columns are %s", name, strings.Join(known, ","))
+		}
+		if seen[name] {
+			return fmt.Errorf("csv column '%s' is listed more than once", name)
+		}
+		seen[name] = true
+	}
+	return nil
+}
+
+func findCsvColumn(name string) (csvColumn, bool) {
+	for _, col := range csvColumns {
+		if col.name == name {
+			return col, true
+		}
+	}
+	return csvColumn{}, false
+}
+
+func (o *CsvOutput) columns() []csvColumn {
+	if len(o.Columns) == 0 {
+		return csvColumns
+	}
+	out := make([]csvColumn, 0, len(o.Columns))
+	for _, name := range o.Columns {
+		if col, found := findCsvColumn(name); found {
+			out = append(out, col)
+		}
+	}
+	return out
+}
+
+var csvColumns = []csvColumn{
 	{"db", func(r Result, s *ScriptResult) string { return fmt.Sprintf("\"%s\"", r.DatabaseName) }},
 	{"script", func(r Result, s *ScriptResult) string { return fmt.Sprintf("\"%s\"", s.ScriptName) }},
 	{"rate", func(r Result, s *ScriptResult) string { return fmtFloat(s.Rate) }},
-	{"succeeded", func(r Result, s *ScriptResult) string { return fmtFloat(s.Latencies.TotalCount()) }},
+	{"succeeded", func(r Result, s *ScriptResult) string { return fmtFloat(s.Succeeded) }},
 	{"failed", func(r Result, s *ScriptResult) string { return fmtFloat(s.Failed) }},
-	{"mean", func(r Result, s *ScriptResult) string { return fmtFloat(s.Latencies.Mean() / 1000.0) }},
-	{"stdev", func(r Result, s *ScriptResult) string { return fmtFloat(s.Latencies.StdDev()) }},
-	{"p0", func(r Result, s *ScriptResult) string { return fmtFloat(float64(s.Latencies.Min()) / 1000.0) }},
+	{"mean", func(r Result, s *ScriptResult) string { return fmtFloat(s.Millis(s.Latencies.Mean())) }},
+	// In microseconds, unlike every other latency column; kept that way so existing consumers of the column don't
+	// break, see stdev_ms
+	{"stdev", func(r Result, s *ScriptResult) string { return fmtFloat(s.Millis(s.Latencies.StdDev()) * 1000) }},
+	{"p0", func(r Result, s *ScriptResult) string { return fmtFloat(s.Millis(float64(s.Latencies.Min()))) }},
 	{"p25", func(r Result, s *ScriptResult) string {
-		return fmtFloat(float64(s.Latencies.ValueAtQuantile(25)) / 1000.0)
+		return fmtFloat(s.Millis(float64(s.Latencies.ValueAtQuantile(25))))
 	}},
 	{"p50", func(r Result, s *ScriptResult) string {
-		return fmtFloat(float64(s.Latencies.ValueAtQuantile(50)) / 1000.0)
+		return fmtFloat(s.Millis(float64(s.Latencies.ValueAtQuantile(50))))
 	}},
 	{"p75", func(r Result, s *ScriptResult) string {
-		return fmtFloat(float64(s.Latencies.ValueAtQuantile(75)) / 1000.0)
+		return fmtFloat(s.Millis(float64(s.Latencies.ValueAtQuantile(75))))
 	}},
 	{"p99", func(r Result, s *ScriptResult) string {
-		return fmtFloat(float64(s.Latencies.ValueAtQuantile(99)) / 1000.0)
+		return fmtFloat(s.Millis(float64(s.Latencies.ValueAtQuantile(99))))
 	}},
 	{"p99999", func(r Result, s *ScriptResult) string {
-		return fmtFloat(float64(s.Latencies.ValueAtQuantile(99.999)) / 1000.0)
+		return fmtFloat(s.Millis(float64(s.Latencies.ValueAtQuantile(99.999))))
 	}},
-	{"p100", func(r Result, s *ScriptResult) string { return fmtFloat(float64(s.Latencies.Max()) / 1000.0) }},
+	{"p100", func(r Result, s *ScriptResult) string { return fmtFloat(s.Millis(float64(s.Latencies.Max()))) }},
+	{"schedule_wait_p50", func(r Result, s *ScriptResult) string { return fmtFloat(quantileMillis(s, s.ScheduleWait, 50)) }},
+	{"schedule_wait_p99", func(r Result, s *ScriptResult) string { return fmtFloat(quantileMillis(s, s.ScheduleWait, 99)) }},
+	{"service_p50", func(r Result, s *ScriptResult) string { return fmtFloat(quantileMillis(s, s.ServiceTime, 50)) }},
+	{"service_p99", func(r Result, s *ScriptResult) string { return fmtFloat(quantileMillis(s, s.ServiceTime, 99)) }},
+	{"stdev_ms", func(r Result, s *ScriptResult) string { return fmtFloat(s.Millis(s.Latencies.StdDev())) }},
 }
 
 func (o *CsvOutput) Errorf(format string, a ...interface{}) {
@@ -451,50 +1108,204 @@ func (o *CsvOutput) Errorf(format string, a ...interface{}) {
 	}
 }
 
-// Call once at app init; starts the prometheus http endpoint
-func InitPrometheus(addr string) {
-	http.Handle("/metrics", promhttp.Handler())
+// Goes to ErrStream to keep stdout strictly CSV
+func (o *CsvOutput) ReportPlan(scriptName, plan string) {
+	writePlan(o.ErrStream, scriptName, plan)
+}
+
+// Each workload's rows already went to OutStream, with the scenario naming its script file
+func (o *CsvOutput) ReportSuite(suite SuiteResult, latencyMode bool) {
+	writeSuiteReport(o.ErrStream, plainNumbers{}, suite, latencyMode)
+}
+
+// Starts an http endpoint at addr publishing the metrics of the given output. The same server answers liveness
+// probes at /healthz, and readiness probes at /readyz, see ReadyHandler.
+func InitPrometheus(addr string, output *PrometheusOutput) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", output.Handler())
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "ok\n")
+	})
+	mux.Handle("/readyz", output.ReadyHandler())
 	go func() {
-		err := http.ListenAndServe(addr, nil)
+		err := http.ListenAndServe(addr, mux)
 		if err != nil {
 			panic(errors.Wrap(err, "prometheus http server failed"))
 		}
 	}()
 }
 
+// Latency quantiles published by PrometheusOutput, with their values for the quantile label
+var prometheusLatencyQuantiles = []struct {
+	percentile float64
+	label      string
+}{
+	{50, "0.5"},
+	{95, "0.95"},
+	{99, "0.99"},
+	{99.9, "0.999"},
+}
+
+// Publishes transaction counts, rates and latencies to prometheus. Each PrometheusOutput has its own registry, rather than using the
+// global default one, so when several benchmarks run in the same process, counts from one never show up in the
+// metrics of another.
 type PrometheusOutput struct {
+	registry              *prometheus.Registry
 	totalSucceededCounter prometheus.Counter
 	totalFailedCounter    prometheus.Counter
+	succeededByScript     *prometheus.CounterVec
+	failedByScript        *prometheus.CounterVec
+	// Of the most recent progress interval while running, and of the whole measurement once the result is reported
+	rateByScript        *prometheus.GaugeVec
+	latencyByScript     *prometheus.GaugeVec
+	latencyMeanByScript *prometheus.GaugeVec
+	latencyMaxByScript  *prometheus.GaugeVec
+	// Transactions added to the counters so far in the current benchmark, by script; checkpoints only cover the
+	// time since the previous one, so the final result is what's left to add after the last of them
+	published map[string]publishedCounts
+	// 1 while a benchmark is running, from BenchmarkStart until its result is reported; accessed atomically. The
+	// benchmarks after the first of --sequential and suites share its BenchmarkStart, so for those it's from their
+	// first progress report
+	running int32
 }
 
 func NewPrometheusOutput() *PrometheusOutput {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+	factory := promauto.With(registry)
 	return &PrometheusOutput{
-		totalSucceededCounter: promauto.NewCounter(prometheus.CounterOpts{
+		registry: registry,
+		totalSucceededCounter: factory.NewCounter(prometheus.CounterOpts{
 			Name: "neobench_successful_transactions_total",
 			Help: "The total number of successful transactions",
 		}),
-		totalFailedCounter: promauto.NewCounter(prometheus.CounterOpts{
+		totalFailedCounter: factory.NewCounter(prometheus.CounterOpts{
 			Name: "neobench_failed_transactions_total",
 			Help: "The total number of failed transactions",
 		}),
+		succeededByScript: factory.NewCounterVec(prometheus.CounterOpts{
+			Name: "neobench_script_successful_transactions_total",
+			Help: "The number of successful transactions, by script",
+		}, []string{"script"}),
+		failedByScript: factory.NewCounterVec(prometheus.CounterOpts{
+			Name: "neobench_script_failed_transactions_total",
+			Help: "The number of failed transactions, by script",
+		}, []string{"script"}),
+		rateByScript: factory.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "neobench_script_transactions_per_second",
+			Help: "The rate of transactions, succeeded and failed, by script",
+		}, []string{"script", "db"}),
+		latencyByScript: factory.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "neobench_script_latency_seconds",
+			Help: "Quantiles of the latency of successful transactions, by script",
+		}, []string{"script", "db", "quantile"}),
+		latencyMeanByScript: factory.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "neobench_script_latency_mean_seconds",
+			Help: "The mean latency of successful transactions, by script",
+		}, []string{"script", "db"}),
+		latencyMaxByScript: factory.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "neobench_script_latency_max_seconds",
+			Help: "The maximum latency of successful transactions, by script",
+		}, []string{"script", "db"}),
+		published: make(map[string]publishedCounts),
 	}
 }
 
+type publishedCounts struct {
+	succeeded, failed int64
+}
+
+// Serves the metrics of this output, and only this output, in the prometheus exposition format
+func (p *PrometheusOutput) Handler() http.Handler {
+	return promhttp.HandlerFor(p.registry, promhttp.HandlerOpts{})
+}
+
+// Answers 200 while a benchmark is running, and 503 otherwise. Benchmarks only start once the driver has
+// connected to the database, so this doubles as a check that the database is reachable.
+func (p *PrometheusOutput) ReadyHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&p.running) == 0 {
+			http.Error(w, "not running", http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = io.WriteString(w, "ok\n")
+	})
+}
+
 func (p *PrometheusOutput) BenchmarkStart(databaseName, url, scenario string) {
+	atomic.StoreInt32(&p.running, 1)
 }
 
 func (p *PrometheusOutput) ReportInitProgress(report ProgressReport) {
 }
 
 func (p *PrometheusOutput) ReportWorkloadProgress(completeness float64, checkpoint Result) {
-	p.totalSucceededCounter.Add(float64(checkpoint.TotalSucceeded()))
-	p.totalFailedCounter.Add(float64(checkpoint.TotalFailed()))
+	atomic.StoreInt32(&p.running, 1)
+	for _, script := range checkpoint.SortedScripts() {
+		p.addCounts(script.ScriptName, script.Succeeded, script.Failed)
+	}
+	p.setGauges(checkpoint)
 }
 
 func (p *PrometheusOutput) ReportThroughput(result Result) {
+	p.reportResult(result)
 }
 
 func (p *PrometheusOutput) ReportLatency(result Result) {
+	p.reportResult(result)
+}
+
+// The result covers the whole measurement, so only what came after the last checkpoint is added to the counters
+func (p *PrometheusOutput) reportResult(result Result) {
+	for _, script := range result.SortedScripts() {
+		published := p.published[script.ScriptName]
+		p.addCounts(script.ScriptName, script.Succeeded-published.succeeded, script.Failed-published.failed)
+	}
+	p.setGauges(result)
+	p.published = make(map[string]publishedCounts)
+	atomic.StoreInt32(&p.running, 0)
+}
+
+func (p *PrometheusOutput) addCounts(scriptName string, succeeded, failed int64) {
+	// Counters can't go down, and shouldn't need to, since checkpoints never add up to more than the result
+	if succeeded < 0 {
+		succeeded = 0
+	}
+	if failed < 0 {
+		failed = 0
+	}
+	p.totalSucceededCounter.Add(float64(succeeded))
+	p.totalFailedCounter.Add(float64(failed))
+	p.succeededByScript.WithLabelValues(scriptName).Add(float64(succeeded))
+	p.failedByScript.WithLabelValues(scriptName).Add(float64(failed))
+	published := p.published[scriptName]
+	published.succeeded += succeeded
+	published.failed += failed
+	p.published[scriptName] = published
+}
+
+// Latencies are left as they were for scripts with no successful transactions in the result, rather than
+// dropping to zero, which would read as the script suddenly having become fast
+func (p *PrometheusOutput) setGauges(result Result) {
+	db := result.DatabaseName
+	if db == "" {
+		db = "<default>"
+	}
+	for _, script := range result.SortedScripts() {
+		p.rateByScript.WithLabelValues(script.ScriptName, db).Set(script.Rate)
+		if script.Succeeded == 0 || script.Latencies == nil {
+			continue
+		}
+		seconds := func(v float64) float64 {
+			return script.Millis(v) / 1000
+		}
+		histo := script.Latencies
+		for _, q := range prometheusLatencyQuantiles {
+			p.latencyByScript.WithLabelValues(script.ScriptName, db, q.label).Set(seconds(float64(histo.ValueAtQuantile(q.percentile))))
+		}
+		p.latencyMeanByScript.WithLabelValues(script.ScriptName, db).Set(seconds(histo.Mean()))
+		p.latencyMaxByScript.WithLabelValues(script.ScriptName, db).Set(seconds(float64(histo.Max())))
+	}
 }
 
 func (p *PrometheusOutput) Errorf(format string, a ...interface{}) {
@@ -502,7 +1313,9 @@ func (p *PrometheusOutput) Errorf(format string, a ...interface{}) {
 
 var _ Output = &PrometheusOutput{}
 
-// Combines multiple output mechanisms; we use this to eg. both write to stdout and publish to prometheus
+// Combines multiple output mechanisms; we use this to eg. both write to stdout and publish to prometheus.
+// Each delegate is given its own copy of any Result, so an output that doesn't stay read-only can't affect what
+// the other outputs see.
 type CombinedOutput struct {
 	delegates []Output
 }
@@ -521,26 +1334,61 @@ func (c *CombinedOutput) ReportInitProgress(report ProgressReport) {
 
 func (c *CombinedOutput) ReportWorkloadProgress(completeness float64, checkpoint Result) {
 	for _, d := range c.delegates {
-		d.ReportWorkloadProgress(completeness, checkpoint)
+		d.ReportWorkloadProgress(completeness, checkpoint.Copy())
 	}
 }
 
 func (c *CombinedOutput) ReportThroughput(result Result) {
 	for _, d := range c.delegates {
-		d.ReportThroughput(result)
+		d.ReportThroughput(result.Copy())
 	}
 }
 
 func (c *CombinedOutput) ReportLatency(result Result) {
 	for _, d := range c.delegates {
-		d.ReportLatency(result)
+		d.ReportLatency(result.Copy())
 	}
 }
 
 func (c *CombinedOutput) Errorf(format string, a ...interface{}) {
 	for _, d := range c.delegates {
-		d.Errorf(format, a)
+		d.Errorf(format, a...)
+	}
+}
+
+// Closes each delegate that holds results back, returning the first error
+func (c *CombinedOutput) Close() error {
+	var firstErr error
+	for _, d := range c.delegates {
+		if closer, ok := d.(io.Closer); ok {
+			if err := closer.Close(); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return firstErr
+}
+
+// Plans are text for people to read, so only the first delegate that can show them gets them
+func (c *CombinedOutput) ReportPlan(scriptName, plan string) {
+	for _, d := range c.delegates {
+		if reporter, ok := d.(PlanReporter); ok {
+			reporter.ReportPlan(scriptName, plan)
+			return
+		}
+	}
+	writePlan(os.Stderr, scriptName, plan)
+}
+
+// Like plans, the suite report is for people to read, so it goes to the first delegate that can show it
+func (c *CombinedOutput) ReportSuite(suite SuiteResult, latencyMode bool) {
+	for _, d := range c.delegates {
+		if reporter, ok := d.(SuiteReporter); ok {
+			reporter.ReportSuite(suite, latencyMode)
+			return
+		}
 	}
+	writeSuiteReport(os.Stderr, plainNumbers{}, suite, latencyMode)
 }
 
 var _ Output = &CombinedOutput{}
@@ -0,0 +1,65 @@
+package neobench
+
+import (
+	"fmt"
+	"github.com/codahale/hdrhistogram"
+	"math"
+	"time"
+)
+
+// Tells whether a pool of paced clients fell behind its schedule because there are too few of them to reach the
+// target rate, rather than because the database is slow; if so, returns a warning saying how many clients would be
+// needed. Meant for the first progress checkpoint, since a shortage of clients shows from the very start, while a
+// database that slows down under load typically takes a while to fall behind.
+//
+// Each client has 1/(rate/numClients) to run each transaction in. The clients are behind if most transactions
+// were dispatched more than that late. If the database served even its fastest transactions within that time,
+// but the typical one took longer, the database is what's holding them back. Otherwise, either even the fastest
+// transactions take longer than a client has for them, so the rate needs more of them in flight at once, or
+// transactions finish in time and the clients themselves can't keep up.
+func DiagnosePacing(checkpoint Result, scripts []string, numClients int, rate float64) (string, bool) {
+	var scheduleWait, serviceTime *hdrhistogram.Histogram
+	resolution := DefaultLatencyResolution
+	achieved := 0.0
+	for _, name := range scripts {
+		script, found := checkpoint.Scripts[name]
+		if !found {
+			continue
+		}
+		achieved += script.Rate
+		if script.ScheduleWait == nil {
+			continue
+		}
+		if script.Resolution != 0 {
+			resolution = script.Resolution
+		}
+		scheduleWait = mergeHistogram(scheduleWait, script.ScheduleWait)
+		serviceTime = mergeHistogram(serviceTime, script.ServiceTime)
+	}
+	if scheduleWait == nil || numClients == 0 || rate <= 0 || achieved <= 0 {
+		return "", false
+	}
+
+	slot := TotalRatePerSecondToDurationPerClient(numClients, rate)
+	quantile := func(h *hdrhistogram.Histogram, q float64) time.Duration {
+		return time.Duration(h.ValueAtQuantile(q)) * resolution
+	}
+	if quantile(scheduleWait, 50) <= slot {
+		return "", false
+	}
+	fastest, typical := quantile(serviceTime, 10), quantile(serviceTime, 50)
+	if fastest < slot && typical >= slot {
+		return "", false
+	}
+
+	needed := int(math.Ceil(float64(numClients) * rate / achieved))
+	reason := fmt.Sprintf("even the fastest transactions take %s, longer than the %s each client has per transaction",
+		fastest, slot)
+	if typical < slot {
+		reason = fmt.Sprintf("transactions take %s, within the %s each client has per transaction, so the clients "+
+			"themselves can't dispatch them fast enough", typical, slot)
+	}
+	return fmt.Sprintf("%d clients can't reach --rate %.3f, they have been behind schedule from the start, reaching "+
+		"%.3f per second: %s. Latencies include the time spent waiting on the clients, not the database; use "+
+		"--clients %d or more to reach the target rate", numClients, rate, achieved, reason, needed), true
+}
@@ -0,0 +1,55 @@
+package neobench
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestDiagnosePacing(t *testing.T) {
+	// 4 clients at 1000/s gives each client 4ms per transaction
+	tests := map[string]struct {
+		scheduleWait  time.Duration
+		fastest       time.Duration
+		typical       time.Duration
+		achieved      float64
+		expectWarning string
+	}{
+		"on schedule": {
+			scheduleWait: time.Millisecond, fastest: 2 * time.Millisecond, typical: 3 * time.Millisecond, achieved: 1000,
+		},
+		"too few clients for the latency": {
+			scheduleWait: 50 * time.Millisecond, fastest: 10 * time.Millisecond, typical: 10 * time.Millisecond, achieved: 400,
+			expectWarning: "longer than the 4ms each client has per transaction. Latencies include the time spent waiting " +
+				"on the clients, not the database; use --clients 10 or more",
+		},
+		"clients can't dispatch fast enough": {
+			scheduleWait: 50 * time.Millisecond, fastest: time.Millisecond, typical: time.Millisecond, achieved: 800,
+			expectWarning: "transactions take 1ms, within the 4ms each client has per transaction, so the clients themselves",
+		},
+		"database is slow": {
+			scheduleWait: 50 * time.Millisecond, fastest: 2 * time.Millisecond, typical: 20 * time.Millisecond, achieved: 400,
+		},
+	}
+
+	for name, tc := range tests {
+		name, tc := name, tc
+		t.Run(name, func(t *testing.T) {
+			script := &ScriptResult{ScriptName: "a", Rate: tc.achieved, Resolution: DefaultLatencyResolution,
+				Latencies: newLatencyHistogram(DefaultLatencyResolution)}
+			for i := 0; i < 100; i++ {
+				service := tc.typical
+				if i < 10 {
+					service = tc.fastest
+				}
+				assert.NoError(t, script.recordScheduleWait(tc.scheduleWait+service, tc.scheduleWait))
+			}
+			checkpoint := NewResult("neo4j", "")
+			checkpoint.Scripts["a"] = script
+
+			warning, ok := DiagnosePacing(checkpoint, []string{"a"}, 4, 1000)
+			assert.Equal(t, tc.expectWarning != "", ok)
+			assert.Contains(t, warning, tc.expectWarning)
+		})
+	}
+}
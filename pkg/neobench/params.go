@@ -0,0 +1,204 @@
+package neobench
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Returned by ClientWorkload.Next once every unit of work in the --replay-params file has been handed out
+var ErrParamsExhausted = errors.New("all recorded units of work have been replayed")
+
+// One line of a parameters file: a unit of work as it was sent to the database, with its queries after local
+// parameters were substituted and the parameters they were sent with
+type recordedUnit struct {
+	Script     string              `json:"script"`
+	Statements []recordedStatement `json:"statements"`
+}
+
+type recordedStatement struct {
+	Query  string                 `json:"query"`
+	Params map[string]interface{} `json:"params"`
+}
+
+// Writes each unit of work clients run to a parameters file, see --record-params. Shared by all clients, so
+// the file has the units in the order clients drew them.
+type ParamsRecorder struct {
+	mut sync.Mutex
+	w   *bufio.Writer
+	enc *json.Encoder
+}
+
+func NewParamsRecorder(w io.Writer) *ParamsRecorder {
+	buffered := bufio.NewWriter(w)
+	enc := json.NewEncoder(buffered)
+	enc.SetEscapeHTML(false)
+	return &ParamsRecorder{w: buffered, enc: enc}
+}
+
+func (r *ParamsRecorder) record(uow UnitOfWork) error {
+	line := recordedUnit{Script: uow.ScriptName, Statements: make([]recordedStatement, 0, len(uow.Statements))}
+	for _, s := range uow.Statements {
+		params, err := encodeParam(s.Params)
+		if err != nil {
+			return errors.Wrapf(err, "failed to record parameters of script '%s'", uow.ScriptName)
+		}
+		line.Statements = append(line.Statements, recordedStatement{Query: s.Query, Params: params.(map[string]interface{})})
+	}
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	return errors.Wrap(r.enc.Encode(line), "failed to record parameters")
+}
+
+// Flushes what has been recorded; the underlying writer is left for the caller to close
+func (r *ParamsRecorder) Close() error {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	return errors.Wrap(r.w.Flush(), "failed to record parameters")
+}
+
+// Hands out the units of work in a parameters file, in order, see --replay-params. Shared by all clients, so
+// each unit is run once, by whichever client asks next.
+type ParamsReplay struct {
+	mut       sync.Mutex
+	r         *bufio.Reader
+	line      int
+	exhausted chan struct{}
+	once      sync.Once
+}
+
+func NewParamsReplay(r io.Reader) *ParamsReplay {
+	return &ParamsReplay{r: bufio.NewReader(r), exhausted: make(chan struct{})}
+}
+
+// Closed once every unit in the file has been handed out
+func (p *ParamsReplay) Exhausted() <-chan struct{} {
+	return p.exhausted
+}
+
+// The next unit of work in the file; its script must be in scripts, which decides how it is run
+func (p *ParamsReplay) next(scripts Scripts) (UnitOfWork, error) {
+	p.mut.Lock()
+	raw, err := p.r.ReadBytes('\n')
+	p.line++
+	line := p.line
+	p.mut.Unlock()
+	if err == io.EOF && len(bytes.TrimSpace(raw)) == 0 {
+		p.once.Do(func() { close(p.exhausted) })
+		return UnitOfWork{}, ErrParamsExhausted
+	}
+	if err != nil && err != io.EOF {
+		return UnitOfWork{}, errors.Wrap(err, "failed to read recorded parameters")
+	}
+
+	var unit recordedUnit
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	if err := dec.Decode(&unit); err != nil {
+		return UnitOfWork{}, errors.Wrapf(err, "invalid recorded parameters on line %d", line)
+	}
+	var script *Script
+	for i := range scripts.Scripts {
+		if scripts.Scripts[i].Name == unit.Script {
+			script = &scripts.Scripts[i]
+		}
+	}
+	if script == nil {
+		return UnitOfWork{}, fmt.Errorf("recorded parameters on line %d are for script '%s', which is not part of "+
+			"this workload; replay with the same scripts the parameters were recorded with", line, unit.Script)
+	}
+
+	uow := UnitOfWork{ScriptName: script.Name, Readonly: script.Readonly, Autocommit: script.Autocommit}
+	for _, s := range unit.Statements {
+		params, err := decodeParam(s.Params)
+		if err != nil {
+			return UnitOfWork{}, errors.Wrapf(err, "invalid recorded parameters on line %d", line)
+		}
+		paramMap := params.(map[string]interface{})
+		if paramMap == nil {
+			paramMap = map[string]interface{}{}
+		}
+		uow.Statements = append(uow.Statements, Statement{Query: s.Query, Params: paramMap})
+	}
+	return uow, nil
+}
+
+// Converts a parameter value for recording. JSON has a single number type, so floats are always written with a
+// decimal point or exponent, and integers never are, which lets them be told apart on replay.
+func encodeParam(v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case nil, bool, string, int, int32, int64:
+		return v, nil
+	case float32:
+		return encodeParam(float64(v))
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return nil, fmt.Errorf("%v can't be recorded", v)
+		}
+		s := strconv.FormatFloat(v, 'g', -1, 64)
+		if !strings.ContainsAny(s, ".e") {
+			s += ".0"
+		}
+		return json.RawMessage(s), nil
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, e := range v {
+			encoded, err := encodeParam(e)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = encoded
+		}
+		return out, nil
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			encoded, err := encodeParam(e)
+			if err != nil {
+				return nil, errors.Wrapf(err, "$%s", k)
+			}
+			out[k] = encoded
+		}
+		return out, nil
+	default:
+		return nil, fmt.Errorf("don't know how to record %v (%T)", v, v)
+	}
+}
+
+// The reverse of encodeParam, for values decoded with json.Decoder.UseNumber
+func decodeParam(v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case json.Number:
+		if strings.ContainsAny(v.String(), ".eE") {
+			return v.Float64()
+		}
+		return v.Int64()
+	case []interface{}:
+		for i, e := range v {
+			decoded, err := decodeParam(e)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = decoded
+		}
+		return v, nil
+	case map[string]interface{}:
+		for k, e := range v {
+			decoded, err := decodeParam(e)
+			if err != nil {
+				return nil, err
+			}
+			v[k] = decoded
+		}
+		return v, nil
+	default:
+		return v, nil
+	}
+}
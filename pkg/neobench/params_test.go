@@ -0,0 +1,60 @@
+package neobench
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestReplaysRecordedParams(t *testing.T) {
+	script, err := Parse("lookup", ":set id random(1, 1000000)\n:set ratio 2.0\n:set mixed [1, 2.5, \"x\", {a: 3.0}]\n"+
+		"MATCH (n) WHERE id(n) = $id RETURN n, $ratio, $mixed, $$id;", 1)
+	assert.NoError(t, err)
+	script.Readonly = true
+	recorded := &bytes.Buffer{}
+	wrk := Workload{
+		Variables:    map[string]interface{}{"scale": int64(1)},
+		Scripts:      NewScripts(script),
+		Rand:         rand.New(rand.NewSource(1337)),
+		Sequences:    NewSequences(),
+		RecordParams: NewParamsRecorder(recorded),
+	}
+	client := wrk.NewClient()
+	original := make([]UnitOfWork, 0)
+	for i := 0; i < 3; i++ {
+		uow, err := client.Next(0)
+		assert.NoError(t, err)
+		original = append(original, uow)
+	}
+	assert.NoError(t, wrk.RecordParams.Close())
+	assert.Equal(t, 3, strings.Count(recorded.String(), "\n"))
+	assert.Contains(t, recorded.String(), `"ratio":2.0`)
+
+	wrk.RecordParams = nil
+	wrk.ReplayParams = NewParamsReplay(bytes.NewReader(recorded.Bytes()))
+	// Another seed, to show the replay doesn't depend on it
+	wrk.Rand = rand.New(rand.NewSource(42))
+	replay := wrk.NewClient()
+	for _, expected := range original {
+		uow, err := replay.Next(0)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, uow)
+	}
+
+	_, err = replay.Next(0)
+	assert.Equal(t, ErrParamsExhausted, err)
+	select {
+	case <-wrk.ReplayParams.Exhausted():
+	default:
+		t.Error("expected replay to be exhausted")
+	}
+}
+
+func TestReplayRejectsUnknownScripts(t *testing.T) {
+	replay := NewParamsReplay(strings.NewReader(`{"script":"other","statements":[{"query":"RETURN 1","params":{}}]}`))
+	_, err := replay.next(NewScripts(Script{Name: "lookup", Weight: 1}))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "script 'other', which is not part of this workload")
+}
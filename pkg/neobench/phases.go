@@ -0,0 +1,98 @@
+package neobench
+
+import (
+	"github.com/codahale/hdrhistogram"
+	"github.com/pkg/errors"
+	"time"
+)
+
+// Phases of a transaction we attribute latency to, when --latency-breakdown is on. In order of occurrence.
+const (
+	// Acquiring a connection from the pool and beginning the transaction; the driver does not expose these
+	// separately. For transaction functions that were retried, this includes the failed attempts.
+	PhaseBegin = "begin"
+	// Time the server reports it took before the first result record was available, summed across statements
+	PhaseServer = "server"
+	// Time the server reports it took to stream the results, summed across statements
+	PhaseStreaming = "streaming"
+	// Whatever else it took to run the statements, as seen by the client; mostly network round trips
+	PhaseNetwork = "network"
+	// Committing the transaction
+	PhaseCommit = "commit"
+)
+
+var Phases = []string{PhaseBegin, PhaseServer, PhaseStreaming, PhaseNetwork, PhaseCommit}
+
+// Time spent in each phase of one transaction
+type phaseTimings struct {
+	// Whether begin and commit were timed; autocommit transactions have neither
+	transactional bool
+	begin         time.Duration
+	server        time.Duration
+	streaming     time.Duration
+	network       time.Duration
+	commit        time.Duration
+}
+
+// Attribute the client-observed time of one statement to server, streaming and network time, based on what the
+// server reports in the result summary
+func (p *phaseTimings) addStatement(elapsed, availableAfter, consumedAfter time.Duration) {
+	p.server += availableAfter
+	p.streaming += consumedAfter
+	if network := elapsed - availableAfter - consumedAfter; network > 0 {
+		p.network += network
+	}
+}
+
+// Only the phases that apply to the transaction; recording zeros for the others would drag their means down
+func (p *phaseTimings) byPhase() map[string]time.Duration {
+	out := map[string]time.Duration{
+		PhaseServer:    p.server,
+		PhaseStreaming: p.streaming,
+		PhaseNetwork:   p.network,
+	}
+	if p.transactional {
+		out[PhaseBegin] = p.begin
+		out[PhaseCommit] = p.commit
+	}
+	return out
+}
+
+func newPhaseHistograms(resolution time.Duration) map[string]*hdrhistogram.Histogram {
+	out := make(map[string]*hdrhistogram.Histogram, len(Phases))
+	for _, phase := range Phases {
+		out[phase] = newLatencyHistogram(resolution)
+	}
+	return out
+}
+
+func recordPhases(histograms map[string]*hdrhistogram.Histogram, timings phaseTimings, resolution time.Duration) error {
+	for phase, duration := range timings.byPhase() {
+		if err := histograms[phase].RecordValue(int64(duration / resolution)); err != nil {
+			return errors.Wrapf(err, "failed to record %s latency: %s", phase, duration)
+		}
+	}
+	return nil
+}
+
+// Merges src into dst, returning dst; if dst is nil, returns a copy of src
+func mergePhases(dst, src map[string]*hdrhistogram.Histogram) map[string]*hdrhistogram.Histogram {
+	if src == nil {
+		return dst
+	}
+	if dst == nil {
+		dst = make(map[string]*hdrhistogram.Histogram, len(src))
+		for phase, histo := range src {
+			dst[phase] = hdrhistogram.Import(histo.Export())
+		}
+		return dst
+	}
+	for phase, histo := range src {
+		if existing, found := dst[phase]; found {
+			existing.Merge(histo)
+		} else {
+			dst[phase] = hdrhistogram.Import(histo.Export())
+		}
+	}
+	return dst
+}
@@ -0,0 +1,48 @@
+package neobench
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAttributesStatementTimeToPhases(t *testing.T) {
+	p := phaseTimings{}
+	p.addStatement(10*time.Millisecond, 6*time.Millisecond, 1*time.Millisecond)
+	// Clock skew between what the server reports and what we observe must not produce negative network time
+	p.addStatement(1*time.Millisecond, 2*time.Millisecond, 0)
+
+	assert.Equal(t, phaseTimings{
+		server:    8 * time.Millisecond,
+		streaming: 1 * time.Millisecond,
+		network:   3 * time.Millisecond,
+	}, p)
+}
+
+func TestMergesPhaseHistograms(t *testing.T) {
+	a, b := newPhaseHistograms(DefaultLatencyResolution), newPhaseHistograms(DefaultLatencyResolution)
+	assert.NoError(t, recordPhases(a, phaseTimings{transactional: true, begin: time.Millisecond, server: 2 * time.Millisecond}, DefaultLatencyResolution))
+	assert.NoError(t, recordPhases(b, phaseTimings{transactional: true, begin: 3 * time.Millisecond, server: 4 * time.Millisecond}, DefaultLatencyResolution))
+
+	merged := mergePhases(mergePhases(nil, a), b)
+
+	assert.Equal(t, int64(2), merged[PhaseBegin].TotalCount())
+	assert.InDelta(t, 2000, merged[PhaseBegin].Mean(), 5)
+	assert.InDelta(t, 3000, merged[PhaseServer].Mean(), 5)
+	// And the source wasn't modified
+	assert.Equal(t, int64(1), a[PhaseBegin].TotalCount())
+}
+
+func TestAutocommitBreakdownHasNoBeginOrCommit(t *testing.T) {
+	script := &ScriptResult{ScriptName: "autocommit.script", Phases: newPhaseHistograms(DefaultLatencyResolution)}
+	assert.NoError(t, recordPhases(script.Phases, phaseTimings{server: 2 * time.Millisecond}, DefaultLatencyResolution))
+
+	assert.Equal(t, int64(0), script.Phases[PhaseBegin].TotalCount())
+	assert.Equal(t, int64(0), script.Phases[PhaseCommit].TotalCount())
+	s := &strings.Builder{}
+	summarizePhases(plainNumbers{}, script, s, "")
+	assert.Contains(t, s.String(), "  begin:            n/a\n")
+	assert.Contains(t, s.String(), "  commit:           n/a\n")
+	assert.Contains(t, s.String(), "  server:       2.000ms 100.00%")
+}
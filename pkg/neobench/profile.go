@@ -0,0 +1,143 @@
+package neobench
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"strings"
+
+	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
+	"github.com/pkg/errors"
+)
+
+// Outputs that can show query plans implement this, see ReportPlan
+type PlanReporter interface {
+	// plan is the profiled plan of each statement of one run of the script, rendered as text
+	ReportPlan(scriptName, plan string)
+}
+
+// Reports the plan through the output if it knows how to show plans, otherwise to stderr
+func ReportPlan(out Output, scriptName, plan string) {
+	if reporter, ok := out.(PlanReporter); ok {
+		reporter.ReportPlan(scriptName, plan)
+		return
+	}
+	writePlan(os.Stderr, scriptName, plan)
+}
+
+func writePlan(w io.Writer, scriptName, plan string) {
+	if _, err := fmt.Fprintf(w, "== Profile of %s ==\n%s\n", scriptName, plan); err != nil {
+		panic(err)
+	}
+}
+
+// The script with the highest mean latency, of those that had at least one successful transaction; nil if none did
+func (r *Result) Slowest() *ScriptResult {
+	var slowest *ScriptResult
+	for _, s := range r.SortedScripts() {
+		if s.Succeeded == 0 {
+			continue
+		}
+		if slowest == nil || s.Latencies.Mean() > slowest.Latencies.Mean() {
+			slowest = s
+		}
+	}
+	return slowest
+}
+
+// Runs the named script of the workload once, with PROFILE prepended to each statement, and returns the plans.
+// Parameters are drawn fresh, the same way the workload draws them. The transaction is rolled back, so
+// scripts that write leave nothing behind; autocommit scripts can't be rolled back, so those are refused.
+func ProfileScript(driver neo4j.Driver, dbName string, wrk Workload, scriptName string) (string, error) {
+	var script *Script
+	for i := range wrk.Scripts.Scripts {
+		if wrk.Scripts.Scripts[i].Name == scriptName {
+			script = &wrk.Scripts.Scripts[i]
+		}
+	}
+	if script == nil {
+		return "", errors.Errorf("no script named '%s' in the workload", scriptName)
+	}
+	if script.Autocommit {
+		return "", errors.Errorf("script '%s' runs in autocommit mode, so profiling it would keep its writes", scriptName)
+	}
+
+	unitOfWork, err := script.Eval(ScriptContext{
+		PreflightMode: true,
+		Script:        *script,
+		Stderr:        os.Stderr,
+		Vars:          createVars(wrk.Variables, 0),
+		Rand:          rand.New(rand.NewSource(wrk.Rand.Int63())),
+		CsvLoader:     wrk.CsvLoader,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	accessMode := neo4j.AccessModeWrite
+	if script.Readonly {
+		accessMode = neo4j.AccessModeRead
+	}
+	session := driver.NewSession(neo4j.SessionConfig{AccessMode: accessMode, DatabaseName: dbName})
+	defer session.Close()
+	tx, err := session.BeginTransaction()
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to profile script '%s'", scriptName)
+	}
+	// Never committed; closing an open transaction rolls it back
+	defer tx.Close()
+
+	s := strings.Builder{}
+	for i, stmt := range unitOfWork.Statements {
+		res, err := tx.Run(fmt.Sprintf("PROFILE %s", stmt.Query), stmt.Params)
+		if err != nil {
+			return "", errors.Wrapf(err, "failed to profile script '%s'", scriptName)
+		}
+		summary, err := res.Consume()
+		if err != nil {
+			return "", errors.Wrapf(err, "failed to profile script '%s'", scriptName)
+		}
+		s.WriteString(fmt.Sprintf("Statement %d: %s\n", i+1, stmt.Query))
+		s.WriteString(fmt.Sprintf("Parameters: %v\n", stmt.Params))
+		if plan := summary.Profile(); plan != nil {
+			s.WriteString(fmt.Sprintf("Total db hits: %d\n", totalDbHits(plan)))
+			formatPlan(plan, &s, "  ")
+		} else {
+			s.WriteString("  (the server returned no plan)\n")
+		}
+	}
+	return s.String(), nil
+}
+
+// Writes the plan as an indented tree, one operator per line
+func formatPlan(plan neo4j.ProfiledPlan, s *strings.Builder, indent string) {
+	s.WriteString(fmt.Sprintf("%s+%s (rows: %d, db hits: %d)", indent, plan.Operator(), plan.Records(), plan.DbHits()))
+	if details := describePlanArguments(plan.Arguments()); details != "" {
+		s.WriteString(" ")
+		s.WriteString(details)
+	}
+	s.WriteString("\n")
+	for _, child := range plan.Children() {
+		formatPlan(child, s, indent+"  ")
+	}
+}
+
+// The server sends lots of arguments; these are the ones that say what an operator actually does
+func describePlanArguments(args map[string]interface{}) string {
+	parts := make([]string, 0)
+	for _, key := range []string{"Details", "ExpandExpression", "LegacyExpression", "KeyNames", "Index"} {
+		if v, found := args[key]; found {
+			parts = append(parts, fmt.Sprintf("%v", v))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+func totalDbHits(plan neo4j.ProfiledPlan) int64 {
+	total := plan.DbHits()
+	for _, child := range plan.Children() {
+		total += totalDbHits(child)
+	}
+	return total
+}
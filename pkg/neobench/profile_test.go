@@ -0,0 +1,63 @@
+package neobench
+
+import (
+	"bytes"
+	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestSlowestPicksHighestMeanLatencyOfScriptsThatSucceeded(t *testing.T) {
+	result := NewResult("neo4j", "")
+	for name, latency := range map[string]int64{"fast": 1000, "slow": 5000, "failing": 0} {
+		script := &ScriptResult{ScriptName: name, Latencies: newLatencyHistogram(DefaultLatencyResolution)}
+		if latency > 0 {
+			script.Succeeded = 1
+			assert.NoError(t, script.Latencies.RecordValue(latency))
+		} else {
+			script.Failed = 10
+		}
+		result.Scripts[name] = script
+	}
+
+	assert.Equal(t, "slow", result.Slowest().ScriptName)
+	empty := NewResult("neo4j", "")
+	assert.Nil(t, empty.Slowest())
+}
+
+type fakePlan struct {
+	operator string
+	args     map[string]interface{}
+	dbHits   int64
+	records  int64
+	children []neo4j.ProfiledPlan
+}
+
+func (p fakePlan) Operator() string                  { return p.operator }
+func (p fakePlan) Arguments() map[string]interface{} { return p.args }
+func (p fakePlan) Identifiers() []string             { return nil }
+func (p fakePlan) DbHits() int64                     { return p.dbHits }
+func (p fakePlan) Records() int64                    { return p.records }
+func (p fakePlan) Children() []neo4j.ProfiledPlan    { return p.children }
+
+func TestFormatPlanAsIndentedTree(t *testing.T) {
+	plan := fakePlan{operator: "ProduceResults", records: 1, children: []neo4j.ProfiledPlan{
+		fakePlan{operator: "NodeIndexSeek", args: map[string]interface{}{"Details": "n:Person(id)"}, dbHits: 2, records: 1},
+	}}
+
+	s := strings.Builder{}
+	formatPlan(plan, &s, "")
+
+	assert.Equal(t, "+ProduceResults (rows: 1, db hits: 0)\n  +NodeIndexSeek (rows: 1, db hits: 2) n:Person(id)\n", s.String())
+	assert.Equal(t, int64(2), totalDbHits(plan))
+}
+
+func TestReportPlanGoesThroughOutputsThatShowPlans(t *testing.T) {
+	out, errOut := &bytes.Buffer{}, &bytes.Buffer{}
+	ReportPlan(&CombinedOutput{delegates: []Output{NewPrometheusOutput(), &CsvOutput{OutStream: out, ErrStream: errOut}}},
+		"a.script", "+ProduceResults\n")
+
+	assert.Empty(t, out.String())
+	assert.Equal(t, "== Profile of a.script ==\n+ProduceResults\n\n", errOut.String())
+}
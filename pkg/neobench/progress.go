@@ -0,0 +1,73 @@
+package neobench
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Decides when progress gets reported; either on a wall-clock cadence, or every N completed transactions.
+// Implements pflag.Value, so it can be used directly as a command line flag, eg. `--progress 10s` or `--progress 10000tx`
+type ProgressTrigger struct {
+	// Report every Interval of wall-clock time; zero if Transactions is set
+	Interval time.Duration
+	// Report every time this many more transactions have completed; zero if Interval is set
+	Transactions int64
+}
+
+func ParseProgressTrigger(raw string) (ProgressTrigger, error) {
+	raw = strings.TrimSpace(raw)
+	if strings.HasSuffix(raw, "tx") {
+		n, err := strconv.ParseInt(strings.TrimSuffix(raw, "tx"), 10, 64)
+		if err != nil || n <= 0 {
+			return ProgressTrigger{}, fmt.Errorf("transaction-count progress interval must be a positive integer followed by 'tx', ex: 10000tx, got '%s'", raw)
+		}
+		return ProgressTrigger{Transactions: n}, nil
+	}
+	interval, err := time.ParseDuration(raw)
+	if err != nil || interval <= 0 {
+		return ProgressTrigger{}, fmt.Errorf("progress interval must be a positive duration like 10s or a transaction count like 10000tx, got '%s'", raw)
+	}
+	return ProgressTrigger{Interval: interval}, nil
+}
+
+func (p *ProgressTrigger) String() string {
+	if p.Transactions > 0 {
+		return fmt.Sprintf("%dtx", p.Transactions)
+	}
+	return p.Interval.String()
+}
+
+func (p *ProgressTrigger) Set(raw string) error {
+	parsed, err := ParseProgressTrigger(raw)
+	if err != nil {
+		return err
+	}
+	*p = parsed
+	return nil
+}
+
+func (p *ProgressTrigger) Type() string {
+	return "interval"
+}
+
+// Running count of failures across progress checkpoints. Each checkpoint only covers the interval since the one
+// before it, which shows a current spike of errors, but not whether there were any earlier; so outputs report both.
+type failureTally struct {
+	total int64
+}
+
+func (f *failureTally) reset() {
+	f.total = 0
+}
+
+// Adds the failures of the checkpoint to the tally, and describes both
+func (f *failureTally) describe(p numberFormat, checkpoint Result) string {
+	interval := checkpoint.TotalFailed()
+	f.total += interval
+	if checkpoint.Duration <= 0 {
+		return p.Sprintf("%d failures since last report, %d in total", interval, f.total)
+	}
+	return p.Sprintf("%d failures in the last %.1fs, %d in total", interval, checkpoint.Duration.Seconds(), f.total)
+}
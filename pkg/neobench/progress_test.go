@@ -0,0 +1,36 @@
+package neobench
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestParseProgressTrigger(t *testing.T) {
+	tests := map[string]struct {
+		expected    ProgressTrigger
+		expectError bool
+	}{
+		"10s":     {expected: ProgressTrigger{Interval: 10 * time.Second}},
+		"1m0s":    {expected: ProgressTrigger{Interval: time.Minute}},
+		"10000tx": {expected: ProgressTrigger{Transactions: 10000}},
+		"0tx":     {expectError: true},
+		"-5s":     {expectError: true},
+		"tx":      {expectError: true},
+		"banana":  {expectError: true},
+	}
+
+	for given, tc := range tests {
+		given, tc := given, tc
+		t.Run(given, func(t *testing.T) {
+			actual, err := ParseProgressTrigger(given)
+			if tc.expectError {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, actual)
+			assert.Equal(t, given, actual.String())
+		})
+	}
+}
@@ -0,0 +1,230 @@
+package neobench
+
+import (
+	"encoding/json"
+	"github.com/codahale/hdrhistogram"
+	"github.com/pkg/errors"
+	"io"
+	"time"
+)
+
+// Results saved with --save-result, so they can be rendered later with `neobench render`. Histograms are stored
+// as hdrhistogram snapshots, so nothing is lost in the round trip.
+type savedResult struct {
+	// Whether this was a --latency run, and so whether to render it as a latency or a throughput report
+	LatencyMode       bool
+	DatabaseName      string
+	Scenario          string
+	LatencySampleRate float64
+	InFlightCapHits   int64 `json:",omitempty"`
+	// Length of the measurement window, in nanoseconds; missing in results saved by older versions
+	Duration           time.Duration `json:",omitempty"`
+	FailedByErrorGroup map[string]savedFailureGroup
+	Scripts            map[string]savedScriptResult
+	ServerMetrics      []ServerMetrics `json:",omitempty"`
+	IntervalRates      []float64       `json:",omitempty"`
+}
+
+type savedFailureGroup struct {
+	Count        int64
+	FirstFailure string
+}
+
+type savedScriptResult struct {
+	Rate      float64
+	Failed    int64
+	Succeeded int64
+	Latencies *hdrhistogram.Snapshot
+	Phases    map[string]*hdrhistogram.Snapshot `json:",omitempty"`
+	// Unit of the histogram values, in nanoseconds; missing means DefaultLatencyResolution
+	Resolution   time.Duration          `json:",omitempty"`
+	Checksums    map[string]int64       `json:",omitempty"`
+	ScheduleWait *hdrhistogram.Snapshot `json:",omitempty"`
+	ServiceTime  *hdrhistogram.Snapshot `json:",omitempty"`
+	// Missing in results saved by older versions, which are then reported as having changed nothing
+	Updates UpdateCounts
+}
+
+// Suites saved with --save-result; each workload is saved like a result of its own
+type savedSuite struct {
+	LatencyMode bool
+	// In the order they ran
+	Workloads []savedSuiteWorkload
+}
+
+type savedSuiteWorkload struct {
+	Name   string
+	Result savedResult
+}
+
+// LoadResult was given a saved suite, which needs LoadSuite
+var ErrSavedSuite = errors.New("this is a saved suite, not a single result")
+
+func SaveResult(w io.Writer, result Result, latencyMode bool) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return errors.Wrap(enc.Encode(saveResult(result, latencyMode)), "failed to save result")
+}
+
+// Saves the result of each workload of a suite, in the order they ran, so `neobench render` can render all of them
+// and the suite report
+func SaveSuite(w io.Writer, suite SuiteResult, latencyMode bool) error {
+	saved := savedSuite{LatencyMode: latencyMode, Workloads: make([]savedSuiteWorkload, 0, len(suite.Names))}
+	for _, name := range suite.Names {
+		saved.Workloads = append(saved.Workloads, savedSuiteWorkload{Name: name, Result: saveResult(suite.Workloads[name], latencyMode)})
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return errors.Wrap(enc.Encode(saved), "failed to save suite")
+}
+
+func saveResult(result Result, latencyMode bool) savedResult {
+	saved := savedResult{
+		LatencyMode:        latencyMode,
+		DatabaseName:       result.DatabaseName,
+		Scenario:           result.Scenario,
+		LatencySampleRate:  result.LatencySampleRate,
+		InFlightCapHits:    result.InFlightCapHits,
+		Duration:           result.Duration,
+		ServerMetrics:      result.ServerMetrics,
+		IntervalRates:      result.IntervalRates,
+		FailedByErrorGroup: make(map[string]savedFailureGroup, len(result.FailedByErrorGroup)),
+		Scripts:            make(map[string]savedScriptResult, len(result.Scripts)),
+	}
+	for name, group := range result.FailedByErrorGroup {
+		firstFailure := ""
+		if group.FirstFailure != nil {
+			firstFailure = group.FirstFailure.Error()
+		}
+		saved.FailedByErrorGroup[name] = savedFailureGroup{Count: group.Count, FirstFailure: firstFailure}
+	}
+	for name, script := range result.Scripts {
+		s := savedScriptResult{
+			Rate:       script.Rate,
+			Failed:     script.Failed,
+			Succeeded:  script.Succeeded,
+			Latencies:  script.Latencies.Export(),
+			Resolution: script.Resolution,
+			Checksums:  script.Checksums,
+			Updates:    script.Updates,
+		}
+		if script.ScheduleWait != nil {
+			s.ScheduleWait = script.ScheduleWait.Export()
+			s.ServiceTime = script.ServiceTime.Export()
+		}
+		if script.Phases != nil {
+			s.Phases = make(map[string]*hdrhistogram.Snapshot, len(script.Phases))
+			for phase, histo := range script.Phases {
+				s.Phases[phase] = histo.Export()
+			}
+		}
+		saved.Scripts[name] = s
+	}
+	return saved
+}
+
+// Loads a result written by SaveResult, and whether it was from a --latency run. The original errors are not
+// kept, so the FirstFailure of each error group only has the message of the original error. Returns
+// ErrSavedSuite if given a suite written by SaveSuite.
+func LoadResult(r io.Reader) (Result, bool, error) {
+	var saved struct {
+		savedResult
+		Workloads []savedSuiteWorkload
+	}
+	if err := json.NewDecoder(r).Decode(&saved); err != nil {
+		return Result{}, false, errors.Wrap(err, "failed to read saved result")
+	}
+	if saved.Workloads != nil {
+		return Result{}, false, ErrSavedSuite
+	}
+	result, err := loadResult(saved.savedResult)
+	return result, saved.LatencyMode, err
+}
+
+// Loads a suite written by SaveSuite, and whether it was run in latency mode
+func LoadSuite(r io.Reader) (SuiteResult, bool, error) {
+	var saved savedSuite
+	if err := json.NewDecoder(r).Decode(&saved); err != nil {
+		return SuiteResult{}, false, errors.Wrap(err, "failed to read saved suite")
+	}
+	if len(saved.Workloads) == 0 {
+		return SuiteResult{}, false, errors.New("saved suite has no workloads")
+	}
+	suite := NewSuiteResult()
+	for _, workload := range saved.Workloads {
+		result, err := loadResult(workload.Result)
+		if err != nil {
+			return SuiteResult{}, false, errors.Wrapf(err, "workload %s", workload.Name)
+		}
+		suite.Add(workload.Name, result)
+	}
+	return suite, saved.LatencyMode, nil
+}
+
+func loadResult(saved savedResult) (Result, error) {
+	result := NewResult(saved.DatabaseName, saved.Scenario)
+	result.LatencySampleRate = saved.LatencySampleRate
+	result.InFlightCapHits = saved.InFlightCapHits
+	result.Duration = saved.Duration
+	result.ServerMetrics = saved.ServerMetrics
+	result.IntervalRates = saved.IntervalRates
+	for name, group := range saved.FailedByErrorGroup {
+		result.FailedByErrorGroup[name] = FailureGroup{Count: group.Count, FirstFailure: errors.New(group.FirstFailure)}
+	}
+	for name, s := range saved.Scripts {
+		if s.Latencies == nil {
+			return Result{}, errors.Errorf("saved result for script %s has no latencies", name)
+		}
+		latencies, err := importHistogram(s.Latencies)
+		if err != nil {
+			return Result{}, errors.Wrapf(err, "saved latencies for script %s", name)
+		}
+		script := &ScriptResult{
+			ScriptName: name,
+			Rate:       s.Rate,
+			Failed:     s.Failed,
+			Succeeded:  s.Succeeded,
+			Latencies:  latencies,
+			Resolution: s.Resolution,
+			Checksums:  s.Checksums,
+			Updates:    s.Updates,
+		}
+		if s.ScheduleWait != nil && s.ServiceTime != nil {
+			if script.ScheduleWait, err = importHistogram(s.ScheduleWait); err != nil {
+				return Result{}, errors.Wrapf(err, "saved schedule wait for script %s", name)
+			}
+			if script.ServiceTime, err = importHistogram(s.ServiceTime); err != nil {
+				return Result{}, errors.Wrapf(err, "saved service time for script %s", name)
+			}
+		}
+		if s.Phases != nil {
+			script.Phases = make(map[string]*hdrhistogram.Histogram, len(s.Phases))
+			for phase, snapshot := range s.Phases {
+				if script.Phases[phase], err = importHistogram(snapshot); err != nil {
+					return Result{}, errors.Wrapf(err, "saved %s latencies for script %s", phase, name)
+				}
+			}
+		}
+		result.Scripts[name] = script
+	}
+	return result, nil
+}
+
+// hdrhistogram.Import panics on snapshots that don't hold together, ex: from a truncated or hand-edited file,
+// so they are checked against a histogram with the same bounds first
+func importHistogram(s *hdrhistogram.Snapshot) (*hdrhistogram.Histogram, error) {
+	if s == nil {
+		return nil, errors.New("histogram is missing")
+	}
+	if s.SignificantFigures < 1 || s.SignificantFigures > 5 {
+		return nil, errors.Errorf("histogram significant figures must be between 1 and 5, got %d", s.SignificantFigures)
+	}
+	if s.LowestTrackableValue < 0 || s.HighestTrackableValue < s.LowestTrackableValue {
+		return nil, errors.Errorf("histogram bounds %d to %d are not a range", s.LowestTrackableValue, s.HighestTrackableValue)
+	}
+	expected := len(hdrhistogram.New(s.LowestTrackableValue, s.HighestTrackableValue, int(s.SignificantFigures)).Export().Counts)
+	if len(s.Counts) != expected {
+		return nil, errors.Errorf("histogram has %d counts, but its bounds need %d; is the file truncated?", len(s.Counts), expected)
+	}
+	return hdrhistogram.Import(s), nil
+}
@@ -0,0 +1,98 @@
+package neobench
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/codahale/hdrhistogram"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestSavedResultRendersLikeTheOriginal(t *testing.T) {
+	result := NewResult("neo4j", " -c 4 --latency")
+	result.LatencySampleRate = 0.5
+	script := &ScriptResult{
+		ScriptName: "myscript",
+		Rate:       12.5,
+		Succeeded:  3,
+		Failed:     1,
+		Latencies:  hdrhistogram.New(0, 60*60*1000000, 3),
+		Phases:     newPhaseHistograms(DefaultLatencyResolution),
+	}
+	for _, v := range []int64{1000, 2000, 30000} {
+		assert.NoError(t, script.Latencies.RecordValue(v))
+		assert.NoError(t, script.Phases[PhaseServer].RecordValue(v/2))
+	}
+	result.Scripts["myscript"] = script
+	result.FailedByErrorGroup["Neo.TransientError.Transaction.DeadlockDetected"] = FailureGroup{
+		Count:        1,
+		FirstFailure: fmt.Errorf("deadlock detected"),
+	}
+
+	saved := &bytes.Buffer{}
+	assert.NoError(t, SaveResult(saved, result, true))
+	loaded, latencyMode, err := LoadResult(saved)
+	assert.NoError(t, err)
+	assert.True(t, latencyMode)
+
+	expected, actual := &bytes.Buffer{}, &bytes.Buffer{}
+	(&InteractiveOutput{OutStream: expected}).ReportLatency(result)
+	(&InteractiveOutput{OutStream: actual}).ReportLatency(loaded)
+	assert.Equal(t, expected.String(), actual.String())
+	assert.Equal(t, script.Phases[PhaseServer].Mean(), loaded.Scripts["myscript"].Phases[PhaseServer].Mean())
+}
+
+func TestSavedSuiteKeepsWorkloadsInOrder(t *testing.T) {
+	suite := NewSuiteResult()
+	for _, name := range []string{"write", "read"} {
+		result := NewResult("neo4j", " -f "+name+".script")
+		result.Scripts[name+".script"] = &ScriptResult{ScriptName: name + ".script", Succeeded: 2, Latencies: newLatencyHistogram(DefaultLatencyResolution)}
+		suite.Add(name, result)
+	}
+
+	saved := &bytes.Buffer{}
+	assert.NoError(t, SaveSuite(saved, suite, true))
+	_, _, err := LoadResult(bytes.NewReader(saved.Bytes()))
+	assert.Equal(t, ErrSavedSuite, err)
+	loaded, latencyMode, err := LoadSuite(saved)
+	assert.NoError(t, err)
+	assert.True(t, latencyMode)
+
+	expected, actual := &bytes.Buffer{}, &bytes.Buffer{}
+	ReportSuite(&InteractiveOutput{OutStream: expected}, suite, true)
+	ReportSuite(&InteractiveOutput{OutStream: actual}, loaded, true)
+	assert.Equal(t, []string{"write", "read"}, loaded.Names)
+	assert.Equal(t, expected.String(), actual.String())
+}
+
+func TestLoadResultRejectsGarbage(t *testing.T) {
+	_, _, err := LoadResult(bytes.NewBufferString("not a result"))
+	assert.Error(t, err)
+}
+
+func TestLoadResultRejectsMalformedHistograms(t *testing.T) {
+	valid := newLatencyHistogram(DefaultLatencyResolution).Export()
+	tests := map[string]func(s *hdrhistogram.Snapshot){
+		"truncated counts":    func(s *hdrhistogram.Snapshot) { s.Counts = s.Counts[:10] },
+		"extra counts":        func(s *hdrhistogram.Snapshot) { s.Counts = append(s.Counts, 1) },
+		"significant figures": func(s *hdrhistogram.Snapshot) { s.SignificantFigures = 0 },
+		"inverted bounds":     func(s *hdrhistogram.Snapshot) { s.LowestTrackableValue = s.HighestTrackableValue + 1 },
+	}
+	for name, corrupt := range tests {
+		name, corrupt := name, corrupt
+		t.Run(name, func(t *testing.T) {
+			snapshot := *valid
+			snapshot.Counts = append([]int64(nil), valid.Counts...)
+			corrupt(&snapshot)
+			saved := savedResult{Scripts: map[string]savedScriptResult{"a.script": {Latencies: &snapshot}}}
+			raw, err := json.Marshal(saved)
+			assert.NoError(t, err)
+
+			assert.NotPanics(t, func() {
+				_, _, err = LoadResult(bytes.NewReader(raw))
+			})
+			assert.Error(t, err)
+		})
+	}
+}
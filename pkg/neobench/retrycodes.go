@@ -0,0 +1,93 @@
+package neobench
+
+import (
+	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
+	"github.com/pkg/errors"
+	"regexp"
+	"strings"
+)
+
+// Stands for the driver's own classification in --retriable-codes: transient errors, other than the ones the
+// client caused by terminating the transaction, and cluster errors that a routing table refresh fixes
+const RetriableCodesDefault = "default"
+
+var retriableCodePattern = regexp.MustCompile(`^[A-Za-z0-9_*]+(\.[A-Za-z0-9_*]+)*$`)
+
+// The error codes transactions are retried on, see --retriable-codes. The zero value leaves it to the driver.
+type RetriableCodes struct {
+	patterns       []*regexp.Regexp
+	includeDefault bool
+}
+
+// Parses a list of error codes, where * matches any run of characters, ex: Neo.TransientError.*, and
+// RetriableCodesDefault includes the driver's own classification
+func ParseRetriableCodes(raw []string) (RetriableCodes, error) {
+	var out RetriableCodes
+	for _, code := range raw {
+		code = strings.TrimSpace(code)
+		if code == RetriableCodesDefault {
+			out.includeDefault = true
+			continue
+		}
+		if !retriableCodePattern.MatchString(code) {
+			return RetriableCodes{}, errors.Errorf("retriable code must be dot-separated letters, digits, _ and * "+
+				"or '%s', ex: Neo.TransientError.*, got '%s'", RetriableCodesDefault, code)
+		}
+		re := regexp.MustCompile("^" + strings.ReplaceAll(regexp.QuoteMeta(code), `\*`, ".*") + "$")
+		out.patterns = append(out.patterns, re)
+	}
+	if !out.Configured() {
+		return RetriableCodes{}, errors.New("retriable codes must list at least one code")
+	}
+	return out, nil
+}
+
+// False for the zero value, where retries are left to the driver
+func (r RetriableCodes) Configured() bool {
+	return r.includeDefault || len(r.patterns) > 0
+}
+
+// Whether err is a server error with one of the codes. Errors from the driver giving up after retrying, and
+// errors that are not from the server, are never retriable here; the driver already retries lost connections.
+func (r RetriableCodes) retriable(err error) bool {
+	var neo4jErr *neo4j.Neo4jError
+	if !errors.As(err, &neo4jErr) {
+		return false
+	}
+	if r.includeDefault && (neo4jErr.IsRetriableTransient() || neo4jErr.IsRetriableCluster()) {
+		return true
+	}
+	for _, re := range r.patterns {
+		if re.MatchString(neo4jErr.Code) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returned from transaction functions in place of server errors that should not be retried. The driver only
+// retries errors that are themselves server errors, so wrapping one stops the driver from retrying it, while
+// grouping and reporting still see the original error.
+type notRetriableError struct {
+	err error
+}
+
+func (e *notRetriableError) Error() string {
+	return e.err.Error()
+}
+
+func (e *notRetriableError) Unwrap() error {
+	return e.err
+}
+
+// Wraps err so the driver won't retry it, if codes are configured and err does not have one of them
+func (r RetriableCodes) stopDriverRetrying(err error) error {
+	if !r.Configured() || r.retriable(err) {
+		return err
+	}
+	var neo4jErr *neo4j.Neo4jError
+	if !errors.As(err, &neo4jErr) {
+		return err
+	}
+	return &notRetriableError{err: err}
+}
@@ -0,0 +1,74 @@
+package neobench
+
+import (
+	"fmt"
+	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestRetriableCodes(t *testing.T) {
+	deadlock := &neo4j.Neo4jError{Code: "Neo.TransientError.Transaction.DeadlockDetected"}
+	busy := &neo4j.Neo4jError{Code: "MyProc.Busy"}
+	notALeader := &neo4j.Neo4jError{Code: "Neo.ClientError.Cluster.NotALeader"}
+	syntax := &neo4j.Neo4jError{Code: "Neo.ClientError.Statement.SyntaxError"}
+	tests := map[string]struct {
+		codes        []string
+		retriable    []error
+		notRetriable []error
+		expectError  bool
+	}{
+		"replacing the default": {
+			codes:        []string{"Neo.TransientError.*", "MyProc.Busy"},
+			retriable:    []error{deadlock, busy, fmt.Errorf("wrapped: %w", busy)},
+			notRetriable: []error{notALeader, syntax, fmt.Errorf("not from the server")},
+		},
+		"extending the default": {
+			codes:        []string{"default", "MyProc.Busy"},
+			retriable:    []error{deadlock, busy, notALeader},
+			notRetriable: []error{syntax},
+		},
+		"exact codes only": {
+			codes:        []string{"MyProc"},
+			notRetriable: []error{busy},
+		},
+		"empty segment":   {codes: []string{"Neo..Busy"}, expectError: true},
+		"not a code":      {codes: []string{"Neo.Transient Error"}, expectError: true},
+		"nothing to list": {codes: []string{}, expectError: true},
+	}
+
+	for name, tc := range tests {
+		name, tc := name, tc
+		t.Run(name, func(t *testing.T) {
+			codes, err := ParseRetriableCodes(tc.codes)
+			if tc.expectError {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			for _, e := range tc.retriable {
+				assert.True(t, codes.retriable(e), e.Error())
+				assert.Equal(t, e, codes.stopDriverRetrying(e))
+			}
+			for _, e := range tc.notRetriable {
+				assert.False(t, codes.retriable(e), e.Error())
+			}
+		})
+	}
+}
+
+func TestStopsDriverRetryingOnlyServerErrorsWithOtherCodes(t *testing.T) {
+	codes, err := ParseRetriableCodes([]string{"MyProc.Busy"})
+	assert.NoError(t, err)
+	deadlock := &neo4j.Neo4jError{Code: "Neo.TransientError.Transaction.DeadlockDetected"}
+
+	stopped := codes.stopDriverRetrying(deadlock)
+	_, isServerError := stopped.(*neo4j.Neo4jError)
+	assert.False(t, isServerError)
+	assert.Equal(t, deadlock.Error(), stopped.Error())
+	assert.Equal(t, "Neo.TransientError.Transaction.DeadlockDetected", groupError(stopped))
+
+	notFromServer := fmt.Errorf("connection reset")
+	assert.Equal(t, notFromServer, codes.stopDriverRetrying(notFromServer))
+	assert.Equal(t, deadlock, RetriableCodes{}.stopDriverRetrying(deadlock))
+}
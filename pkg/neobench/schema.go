@@ -0,0 +1,80 @@
+package neobench
+
+import (
+	"fmt"
+	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
+	"github.com/pkg/errors"
+	"math/rand"
+	"os"
+)
+
+// How long to wait for indexes created by a schema script to come online before giving up
+const awaitIndexesTimeoutSeconds = 600
+
+// Runs the statements of a schema script, see --schema-file, each in its own transaction, and then waits for
+// any indexes to come online, so neither data population nor the benchmark runs against an index that is still
+// being built. Progress is reported as the "schema" section of init.
+func RunSchemaScript(driver neo4j.Driver, dbName string, script Script, vars map[string]interface{}, out Output) error {
+	statements, err := schemaStatements(script, vars)
+	if err != nil {
+		return err
+	}
+
+	session := driver.NewSession(neo4j.SessionConfig{
+		AccessMode:   neo4j.AccessModeWrite,
+		DatabaseName: dbName,
+	})
+	defer session.Close()
+
+	for i, stmt := range statements {
+		out.ReportInitProgress(ProgressReport{
+			Section:      "schema",
+			Step:         fmt.Sprintf("%s, statement %d of %d", script.Name, i+1, len(statements)),
+			Completeness: float64(i) / float64(len(statements)),
+		})
+		if err := runSchemaStatement(session, stmt.Query); err != nil {
+			return errors.Wrapf(err, "statement %d of schema script %s failed: %s", i+1, script.Name, stmt.Query)
+		}
+	}
+
+	out.ReportInitProgress(ProgressReport{
+		Section:      "schema",
+		Step:         "await indexes",
+		Completeness: 1,
+	})
+	err = runSchemaStatement(session, fmt.Sprintf("CALL db.awaitIndexes(%d)", awaitIndexesTimeoutSeconds))
+	return errors.Wrapf(err, "indexes did not come online after schema script %s", script.Name)
+}
+
+// Evaluates the script once for its statements. Schema commands don't take parameters, so statements that
+// use any are rejected here, rather than by the database with a less helpful error; use $$var instead.
+func schemaStatements(script Script, vars map[string]interface{}) ([]Statement, error) {
+	uow, err := script.Eval(ScriptContext{
+		Script:    script,
+		Stderr:    os.Stderr,
+		Vars:      createVars(vars, 0),
+		Rand:      rand.New(rand.NewSource(1337)),
+		CsvLoader: NewCsvLoader(),
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to evaluate schema script %s", script.Name)
+	}
+	for i, stmt := range uow.Statements {
+		for name := range stmt.Params {
+			return nil, errors.Errorf("statement %d of schema script %s uses parameter $%s, but schema commands "+
+				"can't take parameters; use $$%s to substitute the value into the statement instead", i+1, script.Name, name, name)
+		}
+	}
+	return uow.Statements, nil
+}
+
+func runSchemaStatement(session neo4j.Session, query string) error {
+	_, err := session.WriteTransaction(func(tx neo4j.Transaction) (interface{}, error) {
+		res, err := tx.Run(query, nil)
+		if err != nil {
+			return nil, err
+		}
+		return res.Consume()
+	})
+	return err
+}
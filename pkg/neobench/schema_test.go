@@ -0,0 +1,50 @@
+package neobench
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestSchemaStatements(t *testing.T) {
+	vars := map[string]interface{}{"scale": int64(1), "timeout": int64(300)}
+	tests := map[string]struct {
+		script   string
+		expected []string
+		err      bool
+	}{
+		"ddl": {
+			script: `
+// Constraints before bulk load
+CREATE CONSTRAINT ON (p:Person) ASSERT p.id IS UNIQUE;
+CREATE INDEX FOR (p:Person) ON (p.name);`,
+			expected: []string{"CREATE CONSTRAINT ON (p:Person) ASSERT p.id IS UNIQUE", "CREATE INDEX FOR (p:Person) ON (p.name)"},
+		},
+		"local substitution": {
+			script:   `CALL db.awaitIndexes($$timeout);`,
+			expected: []string{`CALL db.awaitIndexes(300)`},
+		},
+		"parameters": {
+			script: `CREATE INDEX FOR (n:Person) ON (n.name) OPTIONS {indexProvider: $provider};`,
+			err:    true,
+		},
+	}
+
+	for name, tc := range tests {
+		name, tc := name, tc
+		t.Run(name, func(t *testing.T) {
+			script, err := Parse("schema.cypher", tc.script, 1)
+			assert.NoError(t, err)
+			statements, err := schemaStatements(script, vars)
+			if tc.err {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			queries := make([]string, 0, len(statements))
+			for _, stmt := range statements {
+				queries = append(queries, stmt.Query)
+			}
+			assert.Equal(t, tc.expected, queries)
+		})
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"math"
 	"math/rand"
 	"path/filepath"
+	"regexp"
 	"sort"
 	"strconv"
 	"strings"
@@ -47,6 +48,34 @@ func Parse(filename, script string, weight float64) (Script, error) {
 	return output, nil
 }
 
+// Matches ${VAR} and ${VAR:-default}
+var envVarPattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// Expands ${VAR} and ${VAR:-default} environment variable references in script text, meant to be called on
+// script files as they are loaded. As in a shell, the default is used when the variable is unset or empty.
+// Unlike a shell, a variable that is unset and has no default is an error, so we don't send a literal ${VAR}
+// off to the database. lookup is normally os.LookupEnv.
+func ExpandEnv(script string, lookup func(string) (string, bool)) (string, error) {
+	missing := make([]string, 0)
+	out := envVarPattern.ReplaceAllStringFunc(script, func(ref string) string {
+		match := envVarPattern.FindStringSubmatch(ref)
+		name, hasDefault, defaultValue := match[1], match[2] != "", match[3]
+		if value, found := lookup(name); found && (value != "" || !hasDefault) {
+			return value
+		}
+		if hasDefault {
+			return defaultValue
+		}
+		missing = append(missing, name)
+		return ref
+	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf("environment variable(s) referenced but not set: %s; set them or give a default, ex: ${%s:-default}",
+			strings.Join(missing, ", "), missing[0])
+	}
+	return out, nil
+}
+
 func parseMetaCommand(s *Script, c *parseContext) {
 	expect(c, ':')
 	cmd := ident(c)
@@ -173,6 +202,65 @@ func parseParams(query, filename string) ([]string, []string) {
 	return outRemoteParams, outLocalParams
 }
 
+// Cypher clauses that modify the database
+var writeClauses = map[string]bool{
+	"CREATE": true,
+	"MERGE":  true,
+	"SET":    true,
+	"DELETE": true,
+	"REMOVE": true,
+	"DROP":   true,
+}
+
+// Finds clauses that write to the database in a query. This tokenizes the query rather than searching
+// for substrings, so write keywords inside strings, comments, backtick-quoted names, property keys, labels
+// map keys and aliases are not mistaken for clauses. It can't see inside procedures; EXPLAIN in WorkloadPreflight
+// covers those.
+func findWriteClauses(query string) []string {
+	c := newParseContext(query, "")
+	// This runs on queries that already parsed; anything still malformed is for the database to report
+	c.s.Error = func(*scanner.Scanner, string) {}
+	found := make([]string, 0)
+	prev, prevKeyword := rune(0), ""
+	for !c.done {
+		tok, text := c.Next()
+		if tok == scanner.EOF {
+			break
+		}
+		if tok == '\n' {
+			continue
+		}
+		keyword := strings.ToUpper(text)
+		if tok == scanner.Ident && writeClauses[keyword] && prevKeyword != "AS" {
+			switch prev {
+			case '.', ':', '$', '(', '[', ',':
+				// Property key, label, parameter or variable name
+			default:
+				if c.PeekToken() != ':' { // map key
+					found = append(found, keyword)
+				}
+			}
+		}
+		prev, prevKeyword = tok, keyword
+	}
+	return found
+}
+
+// Checks that none of the queries in the script contain clauses that write to the database, see --read-only
+func ValidateReadOnly(script Script) error {
+	for _, cmd := range script.Commands {
+		query, ok := cmd.(QueryCommand)
+		if !ok {
+			continue
+		}
+		if clauses := findWriteClauses(query.Query); len(clauses) > 0 {
+			return fmt.Errorf("script '%s' is not read-only, found %s in query: %s",
+				script.Name, strings.Join(clauses, ", "), strings.TrimSpace(query.Query))
+		}
+	}
+	return nil
+}
+
 func ident(c *parseContext) string {
 	name, err := tryIdent(c)
 	if err != nil {
@@ -602,6 +690,7 @@ func (s ListCompExpr) Eval(ctx *ScriptContext) (interface{}, error) {
 		Vars:      make(map[string]interface{}),
 		Rand:      ctx.Rand,
 		CsvLoader: ctx.CsvLoader,
+		Sequences: ctx.Sequences,
 	}
 	for k, v := range ctx.Vars {
 		innerCtx.Vars[k] = v
@@ -906,6 +995,41 @@ func (f CallExpr) Eval(ctx *ScriptContext) (interface{}, error) {
 			return nil, errors.Wrapf(err, "failed resolving path %s relative to %s in %s", path, ctx.Script.Name, f.String())
 		}
 		return ctx.CsvLoader.Load(absPath)
+	case "sequence":
+		name := "default"
+		if len(f.args) > 0 {
+			var err error
+			if name, err = f.argAsString(0, ctx); err != nil {
+				return nil, errors.Wrapf(err, "sequence(..) takes the sequence name as first argument, in %s", f.String())
+			}
+		}
+		start, blockSize := int64(1), int64(1)
+		if len(f.args) > 1 {
+			a, err := f.argAsNumber(1, ctx)
+			if err != nil || a.isDouble {
+				return nil, fmt.Errorf("sequence start must be an integer, in %s", f.String())
+			}
+			start = a.iVal
+		}
+		if len(f.args) > 2 {
+			a, err := f.argAsNumber(2, ctx)
+			if err != nil || a.isDouble || a.iVal < 1 {
+				return nil, fmt.Errorf("sequence block size must be a positive integer, in %s", f.String())
+			}
+			blockSize = a.iVal
+		}
+		// Preflight runs each script once to check it, that shouldn't use up values
+		if ctx.PreflightMode {
+			return start, nil
+		}
+		if ctx.Sequences == nil {
+			return nil, fmt.Errorf("sequence(..) is not available here, in %s", f.String())
+		}
+		value, err := ctx.Sequences.Next(name, start, blockSize)
+		if err != nil {
+			return nil, errors.Wrapf(err, "in %s", f.String())
+		}
+		return value, nil
 	case "*":
 		a, err := f.argAsNumber(0, ctx)
 		if err != nil {
@@ -1171,20 +1295,55 @@ type parseContext struct {
 }
 
 func newParseContext(in, name string) *parseContext {
-	var s scanner.Scanner
-	s.Init(strings.NewReader(in))
-	s.Filename = name
-	s.Whitespace ^= 1 << '\n' // don't skip newlines
+	c := &parseContext{}
+	c.s.Init(strings.NewReader(in))
+	c.s.Filename = name
+	c.s.Whitespace ^= 1 << '\n' // don't skip newlines
+	// Strings are scanned by scanString instead; Cypher strings may be single-quoted and span lines, neither of
+	// which the Go-flavored scanner allows
+	c.s.Mode &^= scanner.ScanChars | scanner.ScanStrings
+	// Left to itself the scanner prints errors, like unterminated comments, to stderr and carries on
+	c.s.Error = func(_ *scanner.Scanner, msg string) {
+		c.fail(errors.New(msg))
+	}
 
-	return &parseContext{
-		s: s,
+	return c
+}
+
+// Scans the next token. Comments are skipped by the scanner, and strings are scanned whole, so that ';' and
+// other delimiters inside either don't end statements or confuse the expression parser.
+func (t *parseContext) scan() (rune, string) {
+	tok := t.s.Scan()
+	if tok == '\'' || tok == '"' {
+		return t.scanString(tok)
+	}
+	return tok, t.s.TokenText()
+}
+
+// Scans the rest of a string literal, after the opening quote; the text returned includes the quotes, and
+// escape sequences are left as-is
+func (t *parseContext) scanString(quote rune) (rune, string) {
+	var b strings.Builder
+	b.WriteRune(quote)
+	for ch := t.s.Next(); ch != quote; ch = t.s.Next() {
+		if ch == scanner.EOF {
+			t.fail(fmt.Errorf("string literal not terminated"))
+			return scanner.EOF, ""
+		}
+		b.WriteRune(ch)
+		if ch == '\\' {
+			if escaped := t.s.Next(); escaped != scanner.EOF {
+				b.WriteRune(escaped)
+			}
+		}
 	}
+	b.WriteRune(quote)
+	return scanner.String, b.String()
 }
 
 func (t *parseContext) Peek() (rune, string) {
 	if len(t.stack) == 0 {
-		token := t.s.Scan()
-		text := t.s.TokenText()
+		token, text := t.scan()
 		t.stack = append(t.stack, parseToken{
 			token: token,
 			text:  text,
@@ -1216,11 +1375,11 @@ func (t *parseContext) Next() (rune, string) {
 		}
 		return next.token, next.text
 	}
-	next := t.s.Scan()
+	next, text := t.scan()
 	if next == scanner.EOF {
 		t.done = true
 	}
-	return next, t.s.TokenText()
+	return next, text
 }
 
 func (t *parseContext) fail(err error) {
@@ -245,6 +245,60 @@ RETURN {sleeptime};`, 1)
 	}, uow.Statements)
 }
 
+// Delimiters inside comments and strings must not end statements; strings may be single-quoted and span lines
+func TestDelimitersInCommentsAndStrings(t *testing.T) {
+	tests := map[string]struct {
+		script        string
+		expectQueries []string
+		expectError   string
+	}{
+		"line comment": {
+			script:        "MATCH (n) // not the end; {\nRETURN n;\nRETURN 2;",
+			expectQueries: []string{"MATCH (n) \nRETURN n", "RETURN 2"},
+		},
+		"block comment": {
+			script:        "/* a; b {\n c; */ RETURN 1;\n\n\t\nRETURN 2;",
+			expectQueries: []string{"RETURN 1", "RETURN 2"},
+		},
+		"commented-out statement": {
+			script:        "RETURN 1;\n// RETURN 2;\n/* RETURN 3; */\n",
+			expectQueries: []string{"RETURN 1"},
+		},
+		"comment markers in strings": {
+			script:        `RETURN 'http://x; /* y', "*/ z";`,
+			expectQueries: []string{`RETURN 'http://x; /* y', "*/ z"`},
+		},
+		"multi-line strings": {
+			script:        "RETURN 'one;\ntwo', \"it's; \\\"three\\\"\nfour\";\nRETURN 2;",
+			expectQueries: []string{"RETURN 'one;\ntwo', \"it's; \\\"three\\\"\nfour\"", "RETURN 2"},
+		},
+		"unterminated comment": {
+			script:      "RETURN 1; /* RETURN 2;",
+			expectError: "comment not terminated",
+		},
+		"unterminated string": {
+			script:      "RETURN 'one;\nRETURN 2;",
+			expectError: "string literal not terminated",
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			script, err := Parse("test", tc.script, 1)
+			if tc.expectError != "" {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), tc.expectError)
+				return
+			}
+			assert.NoError(t, err)
+			queries := make([]string, 0)
+			for _, cmd := range script.Commands {
+				queries = append(queries, cmd.(QueryCommand).Query)
+			}
+			assert.Equal(t, tc.expectQueries, queries)
+		})
+	}
+}
+
 // This allows script authors to bring large datasets into scope, like to randomly pick a value
 // from a big set, but then not have that big set be sent off to the database.
 func TestExcludesUnusedParams(t *testing.T) {
@@ -322,3 +376,71 @@ MATCH (b);`, 1)
 		},
 	}, uow.Statements)
 }
+
+func TestFindWriteClauses(t *testing.T) {
+	tests := map[string][]string{
+		"MATCH (n) RETURN n":                              {},
+		"MATCH (n) SET n.x = 1":                           {"SET"},
+		"create (n)":                                      {"CREATE"},
+		"MATCH (n) DETACH DELETE n":                       {"DELETE"},
+		"MERGE (n:A {id: 1}) ON CREATE SET n.x = 1":       {"MERGE", "CREATE", "SET"},
+		"MATCH (n) REMOVE n:Label":                        {"REMOVE"},
+		"MATCH (n) WHERE n.set = 'CREATE' RETURN n":       {},
+		"MATCH (n:Create) RETURN n.delete":                {},
+		"RETURN {create: 1, merge: \"SET\"}":              {},
+		"MATCH (n) // SET n.x = 1\nRETURN n":              {},
+		"MATCH (n) /* DELETE n */ RETURN n":               {},
+		"MATCH (`set`) RETURN `set`":                      {},
+		"MATCH (create) RETURN $delete":                   {},
+		"CALL { MATCH (n) SET n.x = 1 } RETURN 1":         {"SET"},
+		"MATCH (n) WITH n, collect(n) AS merge RETURN 1":  {},
+		"UNWIND $rows AS row\nCREATE (:Row {id: row.id})": {"CREATE"},
+	}
+
+	for query, expected := range tests {
+		query, expected := query, expected
+		t.Run(query, func(t *testing.T) {
+			assert.Equal(t, expected, findWriteClauses(query))
+		})
+	}
+}
+
+func TestValidateReadOnly(t *testing.T) {
+	readScript, err := Parse("read", ":set id random(1, 10)\nMATCH (n {id: $id}) RETURN n;", 1)
+	assert.NoError(t, err)
+	assert.NoError(t, ValidateReadOnly(readScript))
+
+	writeScript, err := Parse("write", "MATCH (n) RETURN n;\nMATCH (n) SET n.x = 1;", 1)
+	assert.NoError(t, err)
+	assert.EqualError(t, ValidateReadOnly(writeScript), "script 'write' is not read-only, found SET in query: MATCH (n) SET n.x = 1")
+}
+
+func TestExpandEnv(t *testing.T) {
+	env := map[string]string{"PREFIX": "Staging", "EMPTY": ""}
+	lookup := func(name string) (string, bool) {
+		v, found := env[name]
+		return v, found
+	}
+
+	tests := map[string]string{
+		"MATCH (n:${PREFIX}Person) RETURN n;":           "MATCH (n:StagingPerson) RETURN n;",
+		"MATCH (n:${UNSET:-Bench}Person) RETURN n;":     "MATCH (n:BenchPerson) RETURN n;",
+		"MATCH (n:${PREFIX:-Bench}Person) RETURN n;":    "MATCH (n:StagingPerson) RETURN n;",
+		"RETURN '${EMPTY:-fallback}';":                  "RETURN 'fallback';",
+		"RETURN '${EMPTY}';":                            "RETURN '';",
+		"RETURN ${UNSET:-};":                            "RETURN ;",
+		"RETURN $param, $$local, {legacy};":             "RETURN $param, $$local, {legacy};",
+		":set a \"${PREFIX}\"\nRETURN $a + '${PREFIX}'": ":set a \"Staging\"\nRETURN $a + 'Staging'",
+	}
+	for given, expected := range tests {
+		given, expected := given, expected
+		t.Run(given, func(t *testing.T) {
+			actual, err := ExpandEnv(given, lookup)
+			assert.NoError(t, err)
+			assert.Equal(t, expected, actual)
+		})
+	}
+
+	_, err := ExpandEnv("MATCH (n:${NOPE}) WHERE n.x = ${ALSO_NOPE} RETURN n", lookup)
+	assert.EqualError(t, err, "environment variable(s) referenced but not set: NOPE, ALSO_NOPE; set them or give a default, ex: ${NOPE:-default}")
+}
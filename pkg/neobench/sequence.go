@@ -0,0 +1,87 @@
+package neobench
+
+import (
+	"github.com/pkg/errors"
+	"sync"
+	"sync/atomic"
+)
+
+// Named counters shared by all clients of a workload, backing the sequence() script function. Every value of a
+// sequence is handed out exactly once across all clients, so they can be used as unique keys.
+type Sequences struct {
+	mut      sync.Mutex
+	counters map[string]*sequenceCounter
+}
+
+type sequenceCounter struct {
+	// Next value to hand out; accessed atomically
+	next  int64
+	start int64
+}
+
+func NewSequences() *Sequences {
+	return &Sequences{counters: make(map[string]*sequenceCounter)}
+}
+
+func (s *Sequences) counter(name string, start int64) (*sequenceCounter, error) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	c, found := s.counters[name]
+	if !found {
+		c = &sequenceCounter{next: start, start: start}
+		s.counters[name] = c
+	}
+	if c.start != start {
+		return nil, errors.Errorf("sequence '%s' is used with different start values, %d and %d", name, c.start, start)
+	}
+	return c, nil
+}
+
+// Reserves n consecutive values of the named sequence, returning the first
+func (s *Sequences) reserve(name string, start, n int64) (int64, error) {
+	c, err := s.counter(name, start)
+	if err != nil {
+		return 0, err
+	}
+	return atomic.AddInt64(&c.next, n) - n, nil
+}
+
+// Gives each client its own view of the sequences, so it can reserve values in blocks; nil if s is nil
+func (s *Sequences) ForClient() *ClientSequences {
+	if s == nil {
+		return nil
+	}
+	return &ClientSequences{shared: s, blocks: make(map[string]*sequenceBlock)}
+}
+
+// The sequences as seen by one client; not safe for concurrent use
+type ClientSequences struct {
+	shared *Sequences
+	// Values reserved by this client and not yet handed out, by sequence name
+	blocks map[string]*sequenceBlock
+}
+
+type sequenceBlock struct {
+	next, end int64
+}
+
+// Next value of the named sequence. With a block size above 1, the client reserves that many values at a time
+// and hands them out in order, so clients touch the shared counter less often; values are then still unique,
+// but only increase within each client, not across them.
+func (c *ClientSequences) Next(name string, start, blockSize int64) (int64, error) {
+	if blockSize <= 1 {
+		return c.shared.reserve(name, start, 1)
+	}
+	block := c.blocks[name]
+	if block == nil || block.next >= block.end {
+		first, err := c.shared.reserve(name, start, blockSize)
+		if err != nil {
+			return 0, err
+		}
+		block = &sequenceBlock{next: first, end: first + blockSize}
+		c.blocks[name] = block
+	}
+	value := block.next
+	block.next++
+	return value, nil
+}
@@ -0,0 +1,62 @@
+package neobench
+
+import (
+	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"sync"
+	"testing"
+)
+
+func TestSequenceValuesAreUniqueAcrossClients(t *testing.T) {
+	tests := map[string]struct {
+		expr string
+		min  int64
+	}{
+		"default":          {expr: "sequence()", min: 1},
+		"named with start": {expr: `sequence("person", 1000)`, min: 1000},
+		"in blocks":        {expr: `sequence("person", 1, 7)`, min: 1},
+	}
+
+	for name, tc := range tests {
+		name, tc := name, tc
+		t.Run(name, func(t *testing.T) {
+			script, err := Parse("insert", ":set id "+tc.expr+"\nCREATE (:Person {id: $id});", 1)
+			assert.NoError(t, err)
+			wrk := Workload{Scripts: NewScripts(script), Rand: rand.New(rand.NewSource(1337)), Sequences: NewSequences()}
+
+			var mut sync.Mutex
+			seen := make(map[int64]bool)
+			var wg sync.WaitGroup
+			for c := 0; c < 4; c++ {
+				client := wrk.NewClient()
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for i := 0; i < 100; i++ {
+						uow, err := client.Next(0)
+						assert.NoError(t, err)
+						id := uow.Statements[0].Params["id"].(int64)
+						mut.Lock()
+						assert.False(t, seen[id], "%d handed out twice", id)
+						seen[id] = true
+						mut.Unlock()
+					}
+				}()
+			}
+			wg.Wait()
+
+			assert.Len(t, seen, 400)
+			for id := range seen {
+				assert.GreaterOrEqual(t, id, tc.min)
+			}
+		})
+	}
+}
+
+func TestSequenceRejectsConflictingStart(t *testing.T) {
+	sequences := NewSequences().ForClient()
+	_, err := sequences.Next("person", 1, 1)
+	assert.NoError(t, err)
+	_, err = sequences.Next("person", 1000, 1)
+	assert.Error(t, err)
+}
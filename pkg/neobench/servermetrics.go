@@ -0,0 +1,175 @@
+package neobench
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Names of the server metrics neobench picks out of the Neo4j metrics endpoint, see ServerMetrics
+const (
+	// Fraction of page cache lookups that found the page in memory, between 0 and 1
+	ServerPageCacheHitRatio = "page_cache_hit_ratio"
+	// Time the JVM has spent in garbage collection since the server started, summed over collectors
+	ServerGcTimeMillis = "gc_time_ms"
+	// Heap in use by the JVM
+	ServerHeapUsedBytes = "heap_used_bytes"
+)
+
+// A sample of the target's own metrics, see --server-metrics-url. Values only has the metrics the server
+// published; which ones it publishes depends on its version and metrics configuration.
+type ServerMetrics struct {
+	Time   time.Time
+	Values map[string]float64
+}
+
+// Polls the Prometheus endpoint of a Neo4j server, keeping every sample taken
+type ServerMetricsScraper struct {
+	url     string
+	client  *http.Client
+	samples []ServerMetrics
+}
+
+func NewServerMetricsScraper(url string) *ServerMetricsScraper {
+	return &ServerMetricsScraper{
+		url: url,
+		// Samples are taken between progress reports, so a slow server should not hold them up for long
+		client: &http.Client{Timeout: 2 * time.Second},
+	}
+}
+
+// Scrapes the endpoint once, and keeps the sample if it succeeds
+func (s *ServerMetricsScraper) Sample() (ServerMetrics, error) {
+	families, err := scrapeMetrics(s.client, s.url)
+	if err != nil {
+		return ServerMetrics{}, errors.Wrap(err, "failed to scrape server metrics")
+	}
+	sample := ServerMetrics{Time: time.Now(), Values: pickServerMetrics(families)}
+	s.samples = append(s.samples, sample)
+	return sample, nil
+}
+
+// All samples taken so far, oldest first
+func (s *ServerMetricsScraper) Samples() []ServerMetrics {
+	return s.samples
+}
+
+// Picks the metrics neobench reports out of those scraped from Neo4j. Neo4j prefixes its metric names with a
+// configurable prefix, and from 5.0 with the metric scope, ex: neo4j_dbms_page_cache_hit_ratio, so metrics are
+// matched on how their names end rather than on the full name.
+func pickServerMetrics(families map[string]*dto.MetricFamily) map[string]float64 {
+	values := make(map[string]float64)
+	for name, family := range families {
+		var key string
+		switch {
+		case strings.HasSuffix(name, "page_cache_hit_ratio"):
+			key = ServerPageCacheHitRatio
+		case strings.Contains(name, "vm_gc_time_"):
+			key = ServerGcTimeMillis
+		case strings.HasSuffix(name, "vm_heap_used"):
+			key = ServerHeapUsedBytes
+		default:
+			continue
+		}
+		for _, metric := range family.Metric {
+			// There is one GC time counter per collector, which add up; the page cache and heap are shared
+			if key == ServerGcTimeMillis {
+				values[key] += metricValue(metric)
+			} else {
+				values[key] = metricValue(metric)
+			}
+		}
+	}
+	return values
+}
+
+// Fetches and parses the metrics published in the Prometheus text format at url, by metric name
+func scrapeMetrics(client *http.Client, url string) (map[string]*dto.MetricFamily, error) {
+	res, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", url, res.Status)
+	}
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(res.Body)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse metrics from %s", url)
+	}
+	return families, nil
+}
+
+// The value of a counter, gauge or untyped metric; 0 for other types
+func metricValue(m *dto.Metric) float64 {
+	switch {
+	case m.Gauge != nil:
+		return m.Gauge.GetValue()
+	case m.Counter != nil:
+		return m.Counter.GetValue()
+	case m.Untyped != nil:
+		return m.Untyped.GetValue()
+	}
+	return 0
+}
+
+// The key server metrics over a run, from its samples
+type ServerMetricsSummary struct {
+	HasPageCache          bool
+	PageCacheHitRatioMean float64
+	PageCacheHitRatioMin  float64
+	// GC time between the first and last sample, and as a share of the time between them
+	HasGcTime bool
+	GcTime    time.Duration
+	GcShare   float64
+	HasHeap   bool
+	// Bytes
+	HeapUsedMax float64
+}
+
+// Summarizes the given samples, oldest first; false if they have none of the metrics neobench reports. GC time is a counter,
+// so it needs at least two samples.
+func SummarizeServerMetrics(samples []ServerMetrics) (ServerMetricsSummary, bool) {
+	var out ServerMetricsSummary
+	if len(samples) == 0 {
+		return out, false
+	}
+	hitRatioSamples := 0
+	var firstGc, lastGc *ServerMetrics
+	for i, sample := range samples {
+		if ratio, ok := sample.Values[ServerPageCacheHitRatio]; ok {
+			if !out.HasPageCache || ratio < out.PageCacheHitRatioMin {
+				out.PageCacheHitRatioMin = ratio
+			}
+			out.HasPageCache = true
+			out.PageCacheHitRatioMean += ratio
+			hitRatioSamples++
+		}
+		if heap, ok := sample.Values[ServerHeapUsedBytes]; ok {
+			out.HasHeap = true
+			if heap > out.HeapUsedMax {
+				out.HeapUsedMax = heap
+			}
+		}
+		if _, ok := sample.Values[ServerGcTimeMillis]; ok {
+			if firstGc == nil {
+				firstGc = &samples[i]
+			}
+			lastGc = &samples[i]
+		}
+	}
+	if hitRatioSamples > 0 {
+		out.PageCacheHitRatioMean /= float64(hitRatioSamples)
+	}
+	if firstGc != nil && lastGc.Time.After(firstGc.Time) {
+		out.HasGcTime = true
+		out.GcTime = time.Duration((lastGc.Values[ServerGcTimeMillis] - firstGc.Values[ServerGcTimeMillis]) * float64(time.Millisecond))
+		out.GcShare = float64(out.GcTime) / float64(lastGc.Time.Sub(firstGc.Time))
+	}
+	return out, out.HasPageCache || out.HasGcTime || out.HasHeap
+}
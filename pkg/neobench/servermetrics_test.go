@@ -0,0 +1,85 @@
+package neobench
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParseServerMetrics(t *testing.T) {
+	tests := map[string]struct {
+		exposition string
+		expected   map[string]float64
+	}{
+		"neo4j 4": {
+			exposition: `# TYPE neo4j_page_cache_hit_ratio gauge
+neo4j_page_cache_hit_ratio 0.97
+# TYPE neo4j_vm_gc_time_g1_young_generation_total counter
+neo4j_vm_gc_time_g1_young_generation_total 1200
+# TYPE neo4j_vm_gc_time_g1_old_generation_total counter
+neo4j_vm_gc_time_g1_old_generation_total 300
+# TYPE neo4j_vm_heap_used gauge
+neo4j_vm_heap_used 5.24288e+08
+# TYPE neo4j_bolt_connections_opened_total counter
+neo4j_bolt_connections_opened_total 12
+`,
+			expected: map[string]float64{
+				ServerPageCacheHitRatio: 0.97,
+				ServerGcTimeMillis:      1500,
+				ServerHeapUsedBytes:     524288000,
+			},
+		},
+		"neo4j 5": {
+			exposition: `# TYPE neo4j_dbms_page_cache_hit_ratio gauge
+neo4j_dbms_page_cache_hit_ratio 0.5
+# TYPE neo4j_dbms_vm_gc_time_g1_young_generation_total counter
+neo4j_dbms_vm_gc_time_g1_young_generation_total 10
+`,
+			expected: map[string]float64{
+				ServerPageCacheHitRatio: 0.5,
+				ServerGcTimeMillis:      10,
+			},
+		},
+		"metrics not published": {
+			exposition: "# TYPE neo4j_bolt_connections_opened_total counter\nneo4j_bolt_connections_opened_total 12\n",
+			expected:   map[string]float64{},
+		},
+	}
+
+	for name, tc := range tests {
+		name, tc := name, tc
+		t.Run(name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_, _ = w.Write([]byte(tc.exposition))
+			}))
+			defer srv.Close()
+
+			scraper := NewServerMetricsScraper(srv.URL)
+			sample, err := scraper.Sample()
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, sample.Values)
+			assert.Len(t, scraper.Samples(), 1)
+		})
+	}
+}
+
+func TestSummarizeServerMetrics(t *testing.T) {
+	start := time.Unix(1000, 0)
+	summary, ok := SummarizeServerMetrics([]ServerMetrics{
+		{Time: start, Values: map[string]float64{ServerPageCacheHitRatio: 0.9, ServerGcTimeMillis: 1000, ServerHeapUsedBytes: 100}},
+		{Time: start.Add(5 * time.Second), Values: map[string]float64{ServerPageCacheHitRatio: 0.8, ServerHeapUsedBytes: 300}},
+		{Time: start.Add(10 * time.Second), Values: map[string]float64{ServerPageCacheHitRatio: 1.0, ServerGcTimeMillis: 1500, ServerHeapUsedBytes: 200}},
+	})
+
+	assert.True(t, ok)
+	assert.InDelta(t, 0.9, summary.PageCacheHitRatioMean, 0.0001)
+	assert.Equal(t, 0.8, summary.PageCacheHitRatioMin)
+	assert.Equal(t, 500*time.Millisecond, summary.GcTime)
+	assert.InDelta(t, 0.05, summary.GcShare, 0.0001)
+	assert.Equal(t, 300.0, summary.HeapUsedMax)
+
+	_, ok = SummarizeServerMetrics([]ServerMetrics{{Time: start, Values: map[string]float64{}}})
+	assert.False(t, ok)
+}
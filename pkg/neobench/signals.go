@@ -3,6 +3,7 @@ package neobench
 import (
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 )
 
@@ -19,11 +20,10 @@ func SetupSignalHandler() (stopCh chan struct{}, stopFunc func()) {
 	sigCh := make(chan os.Signal, 2)
 	signal.Notify(sigCh, shutdownSignals...)
 
+	// Called from worker goroutines as well as the main one, so may be called concurrently
+	var stopOnce sync.Once
 	stopFunc = func() {
-		if stopCh != nil {
-			close(stopCh)
-			stopCh = nil
-		}
+		stopOnce.Do(func() { close(stopCh) })
 	}
 	go func() {
 		signalCount := 0
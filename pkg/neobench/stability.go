@@ -0,0 +1,40 @@
+package neobench
+
+import "math"
+
+// How much the total transaction rate varied between the progress intervals of a run. Two runs with the same
+// average rate can behave very differently; one steady, the other swinging between stalls and bursts.
+type ThroughputStability struct {
+	Intervals int
+	// Transactions per second, over the intervals
+	Mean   float64
+	StdDev float64
+	Min    float64
+	Max    float64
+	// StdDev as a fraction of Mean; 0 for a perfectly steady rate
+	CoefficientOfVariation float64
+}
+
+// Stability of the throughput over the measurement, from Result.IntervalRates; false if there were fewer than
+// two progress intervals to compare, or no transactions at all
+func (r *Result) ThroughputStability() (ThroughputStability, bool) {
+	if len(r.IntervalRates) < 2 {
+		return ThroughputStability{}, false
+	}
+	out := ThroughputStability{Intervals: len(r.IntervalRates), Min: math.Inf(1), Max: math.Inf(-1)}
+	for _, rate := range r.IntervalRates {
+		out.Mean += rate
+		out.Min = math.Min(out.Min, rate)
+		out.Max = math.Max(out.Max, rate)
+	}
+	out.Mean /= float64(out.Intervals)
+	if out.Mean == 0 {
+		return ThroughputStability{}, false
+	}
+	for _, rate := range r.IntervalRates {
+		out.StdDev += (rate - out.Mean) * (rate - out.Mean)
+	}
+	out.StdDev = math.Sqrt(out.StdDev / float64(out.Intervals))
+	out.CoefficientOfVariation = out.StdDev / out.Mean
+	return out, true
+}
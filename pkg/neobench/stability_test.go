@@ -0,0 +1,63 @@
+package neobench
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestThroughputStability(t *testing.T) {
+	tests := map[string]struct {
+		rates    []float64
+		expected ThroughputStability
+		ok       bool
+	}{
+		"steady": {
+			rates:    []float64{1000, 1000, 1000},
+			expected: ThroughputStability{Intervals: 3, Mean: 1000, Min: 1000, Max: 1000},
+			ok:       true,
+		},
+		"swinging": {
+			rates:    []float64{200, 1800, 200, 1800},
+			expected: ThroughputStability{Intervals: 4, Mean: 1000, StdDev: 800, Min: 200, Max: 1800, CoefficientOfVariation: 0.8},
+			ok:       true,
+		},
+		"single interval": {
+			rates: []float64{1000},
+		},
+		"no transactions": {
+			rates: []float64{0, 0},
+		},
+	}
+
+	for name, tc := range tests {
+		name, tc := name, tc
+		t.Run(name, func(t *testing.T) {
+			result := NewResult("neo4j", "")
+			result.IntervalRates = tc.rates
+			stability, ok := result.ThroughputStability()
+			assert.Equal(t, tc.ok, ok)
+			assert.Equal(t, tc.expected, stability)
+		})
+	}
+}
+
+func TestReportsThroughputStability(t *testing.T) {
+	result := NewResult("neo4j", " -c 1")
+	result.IntervalRates = []float64{200, 1800, 200, 1800}
+
+	saved := &bytes.Buffer{}
+	assert.NoError(t, SaveResult(saved, result, false))
+	loaded, _, err := LoadResult(saved)
+	assert.NoError(t, err)
+
+	for name, report := range map[string]func(o *InteractiveOutput, result Result){
+		"throughput": (*InteractiveOutput).ReportThroughput,
+		"latency":    (*InteractiveOutput).ReportLatency,
+	} {
+		out := &bytes.Buffer{}
+		report(&InteractiveOutput{OutStream: out}, loaded)
+		assert.Contains(t, out.String(), "Throughput varied by 80.0% (coefficient of variation) over 4 progress intervals: "+
+			"mean 1000.000, standard deviation 800.000, min 200.000, max 1800.000 per second\n", name)
+	}
+}
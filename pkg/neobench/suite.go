@@ -0,0 +1,90 @@
+package neobench
+
+import (
+	"fmt"
+	"github.com/codahale/hdrhistogram"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// The results of a suite of workloads run one after the other, see `neobench suite`
+type SuiteResult struct {
+	// Workload names, in the order they ran
+	Names []string
+	// Results by workload name
+	Workloads map[string]Result
+}
+
+func NewSuiteResult() SuiteResult {
+	return SuiteResult{Workloads: make(map[string]Result)}
+}
+
+func (s *SuiteResult) Add(name string, result Result) {
+	if _, found := s.Workloads[name]; !found {
+		s.Names = append(s.Names, name)
+	}
+	s.Workloads[name] = result
+}
+
+// Names a workload in a suite after its file, without directories or extension, ex: workloads/write.script is
+// "write"
+func SuiteWorkloadName(path string) string {
+	base := filepath.Base(path)
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
+
+// Outputs that can show the combined report of a suite implement this, see ReportSuite
+type SuiteReporter interface {
+	// Called once every workload in the suite has run, and been reported on its own
+	ReportSuite(suite SuiteResult, latencyMode bool)
+}
+
+// Reports the suite through the output if it knows how to show suites, otherwise to stderr
+func ReportSuite(out Output, suite SuiteResult, latencyMode bool) {
+	if reporter, ok := out.(SuiteReporter); ok {
+		reporter.ReportSuite(suite, latencyMode)
+		return
+	}
+	writeSuiteReport(os.Stderr, plainNumbers{}, suite, latencyMode)
+}
+
+func writeSuiteReport(w io.Writer, p numberFormat, suite SuiteResult, latencyMode bool) {
+	s := strings.Builder{}
+	s.WriteString("== Suite results ==\n")
+	var succeeded, failed int64
+	for _, name := range suite.Names {
+		result := suite.Workloads[name]
+		succeeded += result.TotalSucceeded()
+		failed += result.TotalFailed()
+		s.WriteString(p.Sprintf("  [%s]: %d successful transactions, %d failed, %.3f per second", name,
+			result.TotalSucceeded(), result.TotalFailed(), result.TotalRate()))
+		if latencyMode {
+			s.WriteString(describeWorkloadLatency(p, result))
+		}
+		s.WriteString("\n")
+	}
+	s.WriteString(p.Sprintf("%d workloads, %d successful transactions, %d failed\n\n", len(suite.Names), succeeded, failed))
+	if _, err := fmt.Fprint(w, s.String()); err != nil {
+		panic(err)
+	}
+}
+
+// Latency percentiles over all scripts of a workload, which share a latency resolution
+func describeWorkloadLatency(p numberFormat, result Result) string {
+	var latencies *hdrhistogram.Histogram
+	var unit *ScriptResult
+	for _, script := range result.SortedScripts() {
+		if script.Succeeded == 0 {
+			continue
+		}
+		latencies = mergeHistogram(latencies, script.Latencies)
+		unit = script
+	}
+	if latencies == nil {
+		return ""
+	}
+	return p.Sprintf(", p50 %.3fms, p99 %.3fms", unit.Millis(float64(latencies.ValueAtQuantile(50))),
+		unit.Millis(float64(latencies.ValueAtQuantile(99))))
+}
@@ -0,0 +1,49 @@
+package neobench
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestSuiteWorkloadName(t *testing.T) {
+	tests := map[string]string{
+		"write.script":           "write",
+		"workloads/read.yaml":    "read",
+		"workloads/no-extension": "no-extension",
+		"/abs/path/mixed.v2.cyp": "mixed.v2",
+	}
+	for path, expected := range tests {
+		assert.Equal(t, expected, SuiteWorkloadName(path), path)
+	}
+}
+
+func TestReportsSuiteInTheOrderWorkloadsRan(t *testing.T) {
+	suite := NewSuiteResult()
+	for _, workload := range []struct {
+		name      string
+		succeeded int
+		latency   time.Duration
+	}{
+		{"write", 10, 2 * time.Millisecond},
+		{"read", 20, time.Millisecond},
+	} {
+		worker := NewWorkerResult(0)
+		for i := 0; i < workload.succeeded; i++ {
+			assert.NoError(t, worker.record(workload.name+".script", workload.latency, uowOutcome{succeeded: true}, true))
+		}
+		assert.NoError(t, worker.record(workload.name+".script", workload.latency, uowOutcome{failureGroup: "deadlock"}, true))
+		result := NewResult("neo4j", " -f "+workload.name+".script")
+		result.Add(worker)
+		result.ReconcileRates(time.Second)
+		suite.Add(workload.name, result)
+	}
+
+	out := &bytes.Buffer{}
+	ReportSuite(&InteractiveOutput{OutStream: out}, suite, true)
+	assert.Equal(t, "== Suite results ==\n"+
+		"  [write]: 10 successful transactions, 1 failed, 11.000 per second, p50 2.000ms, p99 2.000ms\n"+
+		"  [read]: 20 successful transactions, 1 failed, 21.000 per second, p50 1.000ms, p99 1.000ms\n"+
+		"2 workloads, 30 successful transactions, 2 failed\n\n", out.String())
+}
@@ -0,0 +1,70 @@
+package neobench
+
+import (
+	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
+	"strings"
+)
+
+// Changes to the data made by the successful transactions of a script, summed from the counters in the result
+// summaries. Telling transactions that changed data from ones that turned out to be no-ops shows whether a
+// workload with conditional writes actually writes at the rate it is expected to.
+type UpdateCounts struct {
+	// Successful transactions that changed anything at all
+	Changed              int64
+	NodesCreated         int64
+	NodesDeleted         int64
+	RelationshipsCreated int64
+	RelationshipsDeleted int64
+	PropertiesSet        int64
+	LabelsAdded          int64
+	LabelsRemoved        int64
+}
+
+func (u *UpdateCounts) addCounters(c neo4j.Counters) {
+	u.NodesCreated += int64(c.NodesCreated())
+	u.NodesDeleted += int64(c.NodesDeleted())
+	u.RelationshipsCreated += int64(c.RelationshipsCreated())
+	u.RelationshipsDeleted += int64(c.RelationshipsDeleted())
+	u.PropertiesSet += int64(c.PropertiesSet())
+	u.LabelsAdded += int64(c.LabelsAdded())
+	u.LabelsRemoved += int64(c.LabelsRemoved())
+}
+
+func (u *UpdateCounts) add(other UpdateCounts) {
+	u.Changed += other.Changed
+	u.NodesCreated += other.NodesCreated
+	u.NodesDeleted += other.NodesDeleted
+	u.RelationshipsCreated += other.RelationshipsCreated
+	u.RelationshipsDeleted += other.RelationshipsDeleted
+	u.PropertiesSet += other.PropertiesSet
+	u.LabelsAdded += other.LabelsAdded
+	u.LabelsRemoved += other.LabelsRemoved
+}
+
+// Whether any of the counters is above zero, as opposed to whether any transaction changed data
+func (u UpdateCounts) any() bool {
+	return u.NodesCreated+u.NodesDeleted+u.RelationshipsCreated+u.RelationshipsDeleted+u.PropertiesSet+
+		u.LabelsAdded+u.LabelsRemoved > 0
+}
+
+// Describes the counters that are above zero as rates, given how many seconds they were counted over
+func (u UpdateCounts) describeRates(p numberFormat, seconds float64) string {
+	parts := make([]string, 0)
+	for _, counter := range []struct {
+		name  string
+		count int64
+	}{
+		{"nodes created", u.NodesCreated},
+		{"nodes deleted", u.NodesDeleted},
+		{"relationships created", u.RelationshipsCreated},
+		{"relationships deleted", u.RelationshipsDeleted},
+		{"properties set", u.PropertiesSet},
+		{"labels added", u.LabelsAdded},
+		{"labels removed", u.LabelsRemoved},
+	} {
+		if counter.count > 0 {
+			parts = append(parts, p.Sprintf("%.3f %s", float64(counter.count)/seconds, counter.name))
+		}
+	}
+	return strings.Join(parts, ", ") + " per second"
+}
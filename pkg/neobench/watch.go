@@ -0,0 +1,158 @@
+package neobench
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Transaction counts and latencies published by a running neobench at one point in time, read back from the
+// metrics of PrometheusOutput; see `neobench watch`
+type WatchSample struct {
+	Time time.Time
+	// Totals since the run started, by script
+	Succeeded map[string]float64
+	Failed    map[string]float64
+	// Transactions per second, succeeded and failed, over the most recent progress interval, by script
+	Rate map[string]float64
+	// Latency percentiles of the most recent progress interval, in seconds, by script; missing for scripts
+	// that have had no successful transactions yet, and for versions of neobench that don't publish them
+	P50 map[string]float64
+	P99 map[string]float64
+}
+
+// Scrapes the metrics endpoint of a neobench started with --prometheus
+type Watcher struct {
+	url    string
+	client *http.Client
+}
+
+// addr is host:port, as given to --prometheus, or the full url of the metrics endpoint
+func NewWatcher(addr string) *Watcher {
+	url := addr
+	if !strings.Contains(url, "://") {
+		url = "http://" + url
+	}
+	if strings.Count(url, "/") < 3 {
+		url = url + "/metrics"
+	}
+	return &Watcher{url: url, client: &http.Client{Timeout: 5 * time.Second}}
+}
+
+func (w *Watcher) Url() string {
+	return w.url
+}
+
+func (w *Watcher) Sample() (WatchSample, error) {
+	families, err := scrapeMetrics(w.client, w.url)
+	if err != nil {
+		return WatchSample{}, errors.Wrap(err, "failed to scrape neobench metrics")
+	}
+	sample := WatchSample{Time: time.Now(), Succeeded: make(map[string]float64), Failed: make(map[string]float64),
+		Rate: make(map[string]float64), P50: make(map[string]float64), P99: make(map[string]float64)}
+	for name, into := range map[string]map[string]float64{
+		"neobench_script_successful_transactions_total": sample.Succeeded,
+		"neobench_script_failed_transactions_total":     sample.Failed,
+		"neobench_script_transactions_per_second":       sample.Rate,
+	} {
+		family, found := families[name]
+		if !found {
+			continue
+		}
+		for _, metric := range family.Metric {
+			for _, label := range metric.Label {
+				if label.GetName() == "script" {
+					into[label.GetValue()] += metricValue(metric)
+				}
+			}
+		}
+	}
+	if family, found := families["neobench_script_latency_seconds"]; found {
+		for _, metric := range family.Metric {
+			script, into := "", map[string]float64(nil)
+			for _, label := range metric.Label {
+				switch {
+				case label.GetName() == "script":
+					script = label.GetValue()
+				case label.GetName() == "quantile" && label.GetValue() == "0.5":
+					into = sample.P50
+				case label.GetName() == "quantile" && label.GetValue() == "0.99":
+					into = sample.P99
+				}
+			}
+			if into != nil {
+				into[script] = metricValue(metric)
+			}
+		}
+	}
+	return sample, nil
+}
+
+// Writes a table of each script's latest transaction rate and latencies, and totals since the run started.
+//
+// The counters only move at progress reports, so rates are not taken from them, which would alias against
+// the progress interval; the rate is the one neobench published at its latest progress report, and the failure
+// rate its share of failures among the transactions counted since prev, or since the run started if there
+// were none. prev may be the zero value, for the first sample.
+func WriteWatchTable(w io.Writer, prev, cur WatchSample) error {
+	scripts := make([]string, 0, len(cur.Succeeded))
+	for name := range cur.Succeeded {
+		scripts = append(scripts, name)
+	}
+	for name := range cur.Failed {
+		if _, found := cur.Succeeded[name]; !found {
+			scripts = append(scripts, name)
+		}
+	}
+	sort.Strings(scripts)
+
+	rate := func(rate float64, found bool) string {
+		if !found {
+			return "-"
+		}
+		return fmt.Sprintf("%.2f", rate)
+	}
+	failureRate := func(rate, succeeded, failed, prevSucceeded, prevFailed float64) float64 {
+		// Counters start over if neobench is restarted
+		if succeeded+failed > prevSucceeded+prevFailed && failed >= prevFailed {
+			succeeded, failed = succeeded-prevSucceeded, failed-prevFailed
+		}
+		if succeeded+failed == 0 {
+			return 0
+		}
+		return rate * failed / (succeeded + failed)
+	}
+	millis := func(latencies map[string]float64, name string) string {
+		seconds, found := latencies[name]
+		if !found {
+			return "-"
+		}
+		return fmt.Sprintf("%.3fms", seconds*1000)
+	}
+
+	s := strings.Builder{}
+	s.WriteString(fmt.Sprintf("%-30s %12s %12s %12s %12s %14s %14s\n", "SCRIPT", "TPS", "FAILURES/S", "P50", "P99", "SUCCEEDED", "FAILED"))
+	var totalSucceeded, totalFailed, totalRate, totalFailureRate float64
+	anyRate := false
+	for _, name := range scripts {
+		scriptRate, found := cur.Rate[name]
+		scriptFailureRate := failureRate(scriptRate, cur.Succeeded[name], cur.Failed[name], prev.Succeeded[name], prev.Failed[name])
+		s.WriteString(fmt.Sprintf("%-30s %12s %12s %12s %12s %14.0f %14.0f\n", name,
+			rate(scriptRate, found), rate(scriptFailureRate, found), millis(cur.P50, name), millis(cur.P99, name),
+			cur.Succeeded[name], cur.Failed[name]))
+		totalSucceeded += cur.Succeeded[name]
+		totalFailed += cur.Failed[name]
+		totalRate += scriptRate
+		totalFailureRate += scriptFailureRate
+		anyRate = anyRate || found
+	}
+	// Percentiles can't be combined across scripts, so the total has none
+	s.WriteString(fmt.Sprintf("%-30s %12s %12s %12s %12s %14.0f %14.0f\n", "TOTAL",
+		rate(totalRate, anyRate), rate(totalFailureRate, anyRate), "-", "-", totalSucceeded, totalFailed))
+	_, err := fmt.Fprint(w, s.String())
+	return err
+}
@@ -0,0 +1,70 @@
+package neobench
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWatcherUrl(t *testing.T) {
+	tests := map[string]string{
+		"localhost:1234":                   "http://localhost:1234/metrics",
+		":1234":                            "http://:1234/metrics",
+		"http://bench-1:1234":              "http://bench-1:1234/metrics",
+		"https://bench-1/neobench/metrics": "https://bench-1/neobench/metrics",
+	}
+	for addr, expected := range tests {
+		assert.Equal(t, expected, NewWatcher(addr).Url(), addr)
+	}
+}
+
+func TestWatchesRatesAndLatenciesPublishedByPrometheusOutput(t *testing.T) {
+	p := NewPrometheusOutput()
+	srv := httptest.NewServer(p.Handler())
+	defer srv.Close()
+	watcher := NewWatcher(strings.TrimPrefix(srv.URL, "http://"))
+
+	checkpoint := func(succeeded, failed int64, rate float64, latency time.Duration) Result {
+		r := NewResult("neo4j", " -c 1")
+		latencies := newLatencyHistogram(DefaultLatencyResolution)
+		assert.NoError(t, latencies.RecordValue(int64(latency/DefaultLatencyResolution)))
+		r.Scripts["write"] = &ScriptResult{ScriptName: "write", Succeeded: succeeded, Failed: failed, Rate: rate, Latencies: latencies}
+		return r
+	}
+	p.ReportWorkloadProgress(0.1, checkpoint(100, 0, 10, time.Millisecond))
+	first, err := watcher.Sample()
+	assert.NoError(t, err)
+	p.ReportWorkloadProgress(0.2, checkpoint(40, 10, 5, 2*time.Millisecond))
+	second, err := watcher.Sample()
+	assert.NoError(t, err)
+	// No progress report since the previous sample
+	third, err := watcher.Sample()
+	assert.NoError(t, err)
+
+	out := &bytes.Buffer{}
+	assert.NoError(t, WriteWatchTable(out, WatchSample{}, first))
+	assert.Contains(t, out.String(), "write                                 10.00         0.00      1.000ms      1.000ms            100              0\n")
+
+	out.Reset()
+	assert.NoError(t, WriteWatchTable(out, first, second))
+	assert.Contains(t, out.String(), "write                                  5.00         1.00      2.000ms      2.000ms            140             10\n")
+	assert.Contains(t, out.String(), "TOTAL                                  5.00         1.00            -            -            140             10\n")
+
+	out.Reset()
+	assert.NoError(t, WriteWatchTable(out, second, third))
+	assert.Contains(t, out.String(), "write                                  5.00         0.33      2.000ms      2.000ms            140             10\n",
+		"the latest published rate, not zero because the counters haven't moved")
+}
+
+func TestWatchTableShowsMissingLatenciesAsDash(t *testing.T) {
+	sample := WatchSample{
+		Succeeded: map[string]float64{"read": 0},
+		Failed:    map[string]float64{"read": 5},
+	}
+	out := &bytes.Buffer{}
+	assert.NoError(t, WriteWatchTable(out, WatchSample{}, sample))
+	assert.Contains(t, out.String(), "read                                      -            -            -            -              0              5\n")
+}
@@ -1,33 +1,75 @@
 package neobench
 
 import (
-	"github.com/codahale/hdrhistogram"
+	"context"
+	"fmt"
 	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
 	"github.com/pkg/errors"
 	"math/rand"
+	"net"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// How workers wrap the statements of each script in transactions, see --transaction-mode. Scripts marked to run
+// in autocommit mode always do, whatever the mode, since they typically can't run in any other.
+type TransactionMode string
+
+const (
+	// Transaction functions, which the driver retries on transient errors; retries count towards latency
+	TransactionManaged TransactionMode = "managed"
+	// Transactions begun and committed by the worker, with no retries
+	TransactionExplicit TransactionMode = "explicit"
+	// Each statement is run in its own auto-commit transaction
+	TransactionAutocommit TransactionMode = "autocommit"
+)
+
+func ParseTransactionMode(raw string) (TransactionMode, error) {
+	switch mode := TransactionMode(raw); mode {
+	case TransactionManaged, TransactionExplicit, TransactionAutocommit:
+		return mode, nil
+	}
+	return "", errors.Errorf("transaction mode must be 'managed', 'explicit' or 'autocommit', got '%s'", raw)
+}
+
 type Worker struct {
 	workerId int64
-	driver   neo4j.Driver
-	now      func() time.Time
-	sleep    func(duration time.Duration)
+	// Attached to each transaction as metadata, so server-side logs can be correlated with a run; see --run-id
+	runId string
+	// Shared between workers to detect runs of failures, see --abort-after-failures; nil if not enabled
+	failures *FailureStreak
+	// Shared between workers to cap concurrent transactions, see --max-in-flight; nil if not enabled
+	inFlight *InFlightLimit
+	// User-supplied rules for grouping errors, see --error-rule
+	errorRules ErrorRules
+	// Error codes to retry on in place of the driver's classification, see --retriable-codes; zero if not set
+	retriableCodes RetriableCodes
+	// If the worker has been idle longer than this, check its connection is alive before the next transaction;
+	// zero disables the check, see --connection-liveness-check
+	livenessCheckAfter time.Duration
+	driver             neo4j.Driver
+	now                func() time.Time
+	sleep              func(duration time.Duration)
 }
 
 // transactionRate is Time between transactions; this defines the workload rate
 // if the database can't keep up at this pace the workload will report
 // the latency as the time from when the transaction *would* have started,
-// rather than from when it actually started.
+// rather than from when it actually started. The part of that spent waiting to
+// be dispatched is recorded as the schedule wait, and the rest as service time.
 //
 // If transactionRate is 0, we go as fast as we can, this is used to measure throughput
 // If numTransactions is 0, we go until stopCh tells us to stop
 func (w *Worker) RunBenchmark(wrk ClientWorkload, databaseName string, transactionRate time.Duration,
 	numTransactions uint64, stopCh <-chan struct{}, recorder *ResultRecorder) WorkerResult {
+	accessMode := neo4j.AccessModeWrite
+	if wrk.Readonly {
+		accessMode = neo4j.AccessModeRead
+	}
 	session := w.driver.NewSession(neo4j.SessionConfig{
-		AccessMode:   neo4j.AccessModeWrite,
+		AccessMode:   accessMode,
 		DatabaseName: databaseName,
 		Bookmarks:    nil,
 		FetchSize:    neo4j.FetchAll,
@@ -35,10 +77,11 @@ func (w *Worker) RunBenchmark(wrk ClientWorkload, databaseName string, transacti
 	defer session.Close()
 
 	workStartTime := w.now()
-	recorder.totalStart = workStartTime
-	recorder.currentStart = workStartTime
+	recorder.Reset(workStartTime)
 
 	nextStart := workStartTime
+	// When the last transaction finished, to tell how long the connection has been idle
+	var lastUsed time.Time
 
 	transactionCounter := uint64(0)
 
@@ -50,17 +93,50 @@ func (w *Worker) RunBenchmark(wrk ClientWorkload, databaseName string, transacti
 		}
 
 		uow, err := wrk.Next(w.workerId)
+		if err == ErrParamsExhausted {
+			return recorder.Complete(w.now())
+		}
 		if err != nil {
 			return WorkerResult{WorkerId: w.workerId, Error: err}
 		}
 
+		// Whether the connection has been idle long enough to check it, see checkLiveness
+		idleTooLong := w.livenessCheckAfter > 0 && !lastUsed.IsZero() && w.now().Sub(lastUsed) > w.livenessCheckAfter
+
+		waitedForSlot := false
+		if w.inFlight != nil {
+			var ok bool
+			if waitedForSlot, ok = w.inFlight.acquire(stopCh); !ok {
+				return recorder.Complete(w.now())
+			}
+		}
+		dispatched := w.now()
+		// After dispatch, so the check is part of the service time of the transaction, like a driver-side check
+		// would be, rather than looking like the client falling behind schedule
+		if idleTooLong {
+			w.checkLiveness(session, uow)
+		}
 		outcome := w.runUnit(session, uow)
+		if w.inFlight != nil {
+			w.inFlight.release()
+		}
+		outcome.waitedForSlot = waitedForSlot
+		if transactionRate > 0 {
+			outcome.paced = true
+			if outcome.scheduleWait = dispatched.Sub(nextStart); outcome.scheduleWait < 0 {
+				outcome.scheduleWait = 0
+			}
+		}
 
-		uowLatency := w.now().Sub(nextStart)
+		lastUsed = w.now()
+		uowLatency := lastUsed.Sub(nextStart)
 
 		if err = recorder.record(uow.ScriptName, uowLatency, outcome); err != nil {
 			return WorkerResult{WorkerId: w.workerId, Error: err}
 		}
+		if w.failures != nil {
+			w.failures.record(outcome)
+		}
 
 		transactionCounter++
 		if numTransactions != 0 && transactionCounter >= numTransactions {
@@ -87,7 +163,7 @@ func (w *Worker) RunBenchmark(wrk ClientWorkload, databaseName string, transacti
 			// makes us coordinate with the database such that our workload rate exactly matches
 			// the databases ability to process - eg. this measures throughput, but makes the
 			// latencies useless
-			nextStart = time.Now()
+			nextStart = w.now()
 		}
 	}
 }
@@ -106,42 +182,113 @@ func (w *Worker) gatherResults(workloadStats map[string]*ScriptResult, workStart
 	return workloadResults
 }
 
+// The driver version we use has no liveness check of its own, so we run a trivial query instead. If the pooled
+// connection went stale while we were idle, the query fails and the driver discards the connection, so the
+// transaction that follows gets a fresh one rather than failing. The outcome is deliberately not recorded, but
+// the time it takes counts towards the latency of the next transaction, as it would with a driver-side check.
+// It carries the metadata of that transaction, so it can be told apart from other clients' queries server-side.
+func (w *Worker) checkLiveness(session neo4j.Session, uow UnitOfWork) {
+	res, err := session.Run("RETURN 1", nil, w.txMetadata(uow))
+	if err == nil {
+		_, _ = res.Consume()
+	}
+}
+
+// Metadata attached to each transaction, shows up in the query log and in `SHOW TRANSACTIONS` / dbms.listTransactions
+func (w *Worker) txMetadata(uow UnitOfWork) func(*neo4j.TransactionConfig) {
+	return neo4j.WithTxMetadata(map[string]interface{}{
+		"neobench_script": uow.ScriptName,
+		"neobench_run":    w.runId,
+	})
+}
+
 func (w *Worker) runUnit(session neo4j.Session, uow UnitOfWork) uowOutcome {
+	txConfig := w.txMetadata(uow)
+	var timings phaseTimings
+	var workStart, workEnd time.Time
+	var checksum *resultChecksum
+	if uow.ChecksumResults != ChecksumOff {
+		checksum = newResultChecksum(uow.ChecksumResults)
+	}
+	var updates UpdateCounts
+	runStatement := func(run func(s Statement) (neo4j.Result, error), s Statement) (neo4j.Result, error) {
+		runStart := w.now()
+		res, err := run(s)
+		if err != nil {
+			return nil, err
+		}
+		var rows [][]byte
+		if checksum != nil {
+			for res.Next() {
+				rows = append(rows, checksum.rowSum(res.Record()))
+			}
+		}
+		summary, err := res.Consume()
+		if err != nil {
+			return nil, err
+		}
+		if checksum != nil {
+			checksum.addStatement(rows)
+		}
+		timings.addStatement(w.now().Sub(runStart), summary.ResultAvailableAfter(), summary.ResultConsumedAfter())
+		updates.addCounters(summary.Counters())
+		if summary.Counters().ContainsUpdates() {
+			updates.Changed = 1
+		}
+		return res, nil
+	}
+
 	transaction := func(tx neo4j.Transaction) (interface{}, error) {
 		var lastResult neo4j.Result
+		// If the driver retries us, only the last attempt counts towards statement timings
+		workStart = w.now()
+		timings = phaseTimings{}
+		updates = UpdateCounts{}
+		if checksum != nil {
+			checksum = newResultChecksum(uow.ChecksumResults)
+		}
+		run := func(s Statement) (neo4j.Result, error) { return tx.Run(s.Query, s.Params) }
 
 		for _, s := range uow.Statements {
-			res, err := tx.Run(s.Query, s.Params)
+			res, err := runStatement(run, s)
 			if err != nil {
-				return nil, err
-			}
-			_, err = res.(neo4j.Result).Consume()
-			if err != nil {
-				return nil, err
+				return nil, w.retriableCodes.stopDriverRetrying(err)
 			}
 			lastResult = res
 		}
+		workEnd = w.now()
 		return lastResult, nil
 	}
 
+	// The driver retries the errors it classifies as retriable itself; errors it gives up on straight away, but
+	// that match --retriable-codes, are retried here, sharing the retry budget of autocommit transactions. The
+	// driver commits the transaction after the function returns, so errors on commit never reach
+	// stopDriverRetrying, and are retried by the driver's classification regardless of --retriable-codes.
+	managedTransaction := func(run func(neo4j.TransactionWork, ...func(*neo4j.TransactionConfig)) (interface{}, error)) (interface{}, error) {
+		res, err := run(transaction, txConfig)
+		for i := 0; i < maxRetries && err != nil && w.retriableCodes.retriable(err); i++ {
+			w.backoff(i)
+			res, err = run(transaction, txConfig)
+		}
+		return res, err
+	}
+
 	autocommitTransaction := func(session neo4j.Session) (interface{}, error) {
 		var lastResult neo4j.Result
-		var retries = 20
-		var res interface{}
+		var retries = maxRetries
+		var res neo4j.Result
 		var err error
+		run := func(s Statement) (neo4j.Result, error) { return session.Run(s.Query, s.Params, txConfig) }
 
 		for _, s := range uow.Statements {
 			var retriesThisTime = retries
 			for i := 0; i < retriesThisTime; i++ {
-				res, err = session.Run(s.Query, s.Params)
-				if err == nil {
-					_, err = res.(neo4j.Result).Consume()
-				}
-				if err == nil {
+				res, err = runStatement(run, s)
+				// Without --retriable-codes, any error is retried
+				if err == nil || (w.retriableCodes.Configured() && !w.retriableCodes.retriable(err)) {
 					break
 				}
-				jitter := rand.Intn(100)
-				w.sleep(time.Duration(i*10+jitter) * time.Millisecond)
+				w.backoff(i)
 				retries = retries - 1
 			}
 
@@ -149,31 +296,70 @@ func (w *Worker) runUnit(session neo4j.Session, uow UnitOfWork) uowOutcome {
 				return nil, err
 			}
 
-			lastResult = res.(neo4j.Result)
+			lastResult = res
 		}
 		return lastResult, nil
 	}
 
-	var err error
-	if uow.Readonly {
-		_, err = session.ReadTransaction(transaction)
-	} else {
-		if uow.Autocommit {
-			_, err = autocommitTransaction(session)
-		} else {
-			_, err = session.WriteTransaction(transaction)
+	// Explicit transactions go by the access mode of the session, so unlike managed read transactions, they are
+	// only routed to followers with --read-only
+	explicitTransaction := func(session neo4j.Session) (interface{}, error) {
+		tx, err := session.BeginTransaction(txConfig)
+		if err != nil {
+			return nil, err
 		}
+		// Rolls back, unless we got to commit
+		defer tx.Close()
+		res, err := transaction(tx)
+		if err != nil {
+			return nil, err
+		}
+		return res, tx.Commit()
+	}
+
+	var err error
+	start := w.now()
+	switch {
+	case uow.TransactionMode == TransactionAutocommit:
+		_, err = autocommitTransaction(session)
+	case uow.TransactionMode == TransactionExplicit && !uow.Autocommit:
+		_, err = explicitTransaction(session)
+	case uow.Readonly:
+		_, err = managedTransaction(session.ReadTransaction)
+	case uow.Autocommit:
+		_, err = autocommitTransaction(session)
+	default:
+		_, err = managedTransaction(session.WriteTransaction)
 	}
 
 	if err != nil {
 		return uowOutcome{
 			succeeded:    false,
-			failureGroup: groupError(err),
+			failureGroup: w.errorRules.groupError(err),
 			err:          err,
 		}
 	}
 
-	return uowOutcome{succeeded: true}
+	if !workStart.IsZero() {
+		timings.transactional = true
+		timings.begin = workStart.Sub(start)
+		timings.commit = w.now().Sub(workEnd)
+	}
+	outcome := uowOutcome{succeeded: true, phases: timings, updates: updates}
+	if checksum != nil {
+		outcome.checksum = checksum.sum()
+	}
+	return outcome
+}
+
+// Retries for a unit of work that neobench retries itself, rather than leaving to the driver
+const maxRetries = 20
+
+// Waits before the given retry, longer the more retries there have been, with jitter so clients that failed
+// together don't all retry at once
+func (w *Worker) backoff(retry int) {
+	jitter := rand.Intn(100)
+	w.sleep(time.Duration(retry*10+jitter) * time.Millisecond)
 }
 
 // Converts a total target rate into a per-client "pacing" duration, used to slow down workers to match
@@ -186,8 +372,25 @@ func TotalRatePerSecondToDurationPerClient(numClients int, rate float64) time.Du
 // Concurrent data structure; used by the worker to record progress, accessible from other threads
 // to read progress checkpoints.
 type ResultRecorder struct {
+	// Times recording a transaction had to wait for a reader of the results, and times reading the results
+	// had to wait for the worker recording; see Contention. First in the struct so they're 64-bit aligned for
+	// atomic access on 32-bit platforms.
+	recordBlocked int64
+	readBlocked   int64
+	// Goroutines holding or waiting for mut
+	lockers int32
+
 	mut sync.Mutex
 
+	// Fraction of transactions to record latencies for, 1 means record all of them
+	latencySampleRate float64
+	// Used to pick which transactions to sample; only touched by the worker thread recording results
+	rand *rand.Rand
+	// Record time spent in each transaction phase, see --latency-breakdown
+	latencyBreakdown bool
+	// Unit to record latencies in, see ScriptResult.Resolution
+	latencyResolution time.Duration
+
 	// Stats since last progress report, read and reset by calling ProgressReport
 	current      WorkerResult
 	currentStart time.Time
@@ -195,44 +398,111 @@ type ResultRecorder struct {
 	// Total since the workload started
 	total      WorkerResult
 	totalStart time.Time
+
+	// Number of transactions, succeeded or failed, recorded since the workload started
+	completed int64
 }
 
-func NewResultRecorder(workerId int64) *ResultRecorder {
-	return &ResultRecorder{
-		current: NewWorkerResult(workerId),
-		total:   NewWorkerResult(workerId),
+// latencySampleRate is the fraction of transactions to record latencies for, between 0 and 1. Which transactions
+// are sampled is a uniform random choice made using r; r may be nil if latencySampleRate is 1.
+// Transactions are always counted towards rate and success/failure, regardless of sampling.
+// If latencyBreakdown is set, the time spent in each of the Phases of a transaction is recorded as well.
+// Latencies are recorded as whole multiples of latencyResolution, normally DefaultLatencyResolution.
+func NewResultRecorder(workerId int64, latencySampleRate float64, r *rand.Rand, latencyBreakdown bool,
+	latencyResolution time.Duration) *ResultRecorder {
+	t := &ResultRecorder{
+		latencySampleRate: latencySampleRate,
+		rand:              r,
+		latencyBreakdown:  latencyBreakdown,
+		latencyResolution: latencyResolution,
 	}
+	t.current = t.newWorkerResult(workerId)
+	t.total = t.newWorkerResult(workerId)
+	return t
 }
 
-func (t *ResultRecorder) record(scriptName string, latency time.Duration, outcome uowOutcome) error {
+// Takes the lock, counting it in blocked if someone else held or was waiting for it; blocked may be nil
+func (t *ResultRecorder) lock(blocked *int64) {
+	if atomic.AddInt32(&t.lockers, 1) > 1 && blocked != nil {
+		atomic.AddInt64(blocked, 1)
+	}
 	t.mut.Lock()
-	defer t.mut.Unlock()
+}
+
+func (t *ResultRecorder) unlock() {
+	t.mut.Unlock()
+	atomic.AddInt32(&t.lockers, -1)
+}
+
+// How many times the worker had to wait to record a transaction because the results were being read, eg. for a
+// progress report, and how many times reading the results had to wait for the worker. Used to tell if
+// collecting results is itself affecting the timing of the benchmark, see --verbose.
+func (t *ResultRecorder) Contention() (recordBlocked, readBlocked int64) {
+	return atomic.LoadInt64(&t.recordBlocked), atomic.LoadInt64(&t.readBlocked)
+}
 
-	if err := t.current.record(scriptName, latency, outcome); err != nil {
+func (t *ResultRecorder) newWorkerResult(workerId int64) WorkerResult {
+	out := NewWorkerResult(workerId)
+	out.LatencySampleRate = t.latencySampleRate
+	out.latencyBreakdown = t.latencyBreakdown
+	out.latencyResolution = t.latencyResolution
+	return out
+}
+
+func (t *ResultRecorder) record(scriptName string, latency time.Duration, outcome uowOutcome) error {
+	// Decide once, so the progress and the total results agree on which transactions were sampled
+	sampled := t.latencySampleRate >= 1 || t.rand.Float64() < t.latencySampleRate
+
+	t.lock(&t.recordBlocked)
+	defer t.unlock()
+
+	if err := t.current.record(scriptName, latency, outcome, sampled); err != nil {
 		return err
 	}
-	return t.total.record(scriptName, latency, outcome)
+	t.completed++
+	return t.total.record(scriptName, latency, outcome, sampled)
+}
+
+// Number of transactions completed, succeeded or failed, since the workload started. Unlike ProgressReport,
+// this does not reset anything, so it's cheap to poll when deciding if it's time to report progress.
+func (t *ResultRecorder) Completed() int64 {
+	t.lock(&t.readBlocked)
+	defer t.unlock()
+	return t.completed
+}
+
+// Discards everything recorded so far, and starts measuring from now; used at worker start, and to
+// throw away results recorded during warmup
+func (t *ResultRecorder) Reset(now time.Time) {
+	t.lock(nil)
+	defer t.unlock()
+
+	t.current = t.newWorkerResult(t.current.WorkerId)
+	t.currentStart = now
+	t.total = t.newWorkerResult(t.total.WorkerId)
+	t.totalStart = now
+	t.completed = 0
 }
 
 // Reports progress since last time you called this function
 func (t *ResultRecorder) ProgressReport(now time.Time) WorkerResult {
-	t.mut.Lock()
-	defer t.mut.Unlock()
+	t.lock(&t.readBlocked)
+	defer t.unlock()
 
 	out := t.current
 
 	delta := now.Sub(t.currentStart)
 	out.calculateRate(delta)
 
-	t.current = NewWorkerResult(out.WorkerId)
+	t.current = t.newWorkerResult(out.WorkerId)
 	t.currentStart = now
 
 	return out
 }
 
 func (t *ResultRecorder) Complete(now time.Time) WorkerResult {
-	t.mut.Lock()
-	defer t.mut.Unlock()
+	t.lock(&t.readBlocked)
+	defer t.unlock()
 
 	out := t.total
 
@@ -241,7 +511,7 @@ func (t *ResultRecorder) Complete(now time.Time) WorkerResult {
 
 	// Not needed at the time of writing this, but since we're returning pointers
 	// (the maps etc inside t.total), clear this structures references before we exit the mutex
-	t.total = NewWorkerResult(out.WorkerId)
+	t.total = t.newWorkerResult(out.WorkerId)
 	t.totalStart = now
 
 	return out
@@ -250,6 +520,8 @@ func (t *ResultRecorder) Complete(now time.Time) WorkerResult {
 func NewWorkerResult(workerId int64) WorkerResult {
 	return WorkerResult{
 		WorkerId:           workerId,
+		LatencySampleRate:  1,
+		latencyResolution:  DefaultLatencyResolution,
 		Scripts:            make(map[string]*ScriptResult),
 		FailedByErrorGroup: make(map[string]FailureGroup),
 	}
@@ -262,11 +534,22 @@ type WorkerResult struct {
 	// if this is set, the rest of this struct will be 0-ed
 	Error error
 
+	// Fraction of successful transactions that had their latency recorded in Scripts[..].Latencies
+	LatencySampleRate float64
+
 	// Statistics grouped by scripts this worker ran
 	Scripts map[string]*ScriptResult
 
 	// Failure counts by cause
 	FailedByErrorGroup map[string]FailureGroup
+
+	// Number of transactions that had to wait for a free slot under --max-in-flight
+	InFlightCapHits int64
+
+	// If set, record the time spent in each transaction phase into Scripts[..].Phases
+	latencyBreakdown bool
+	// Unit latencies are recorded in, see ScriptResult.Resolution
+	latencyResolution time.Duration
 }
 
 func (r *WorkerResult) getOrCreateScriptResult(scriptName string) *ScriptResult {
@@ -276,27 +559,56 @@ func (r *WorkerResult) getOrCreateScriptResult(scriptName string) *ScriptResult
 	}
 	stats = &ScriptResult{
 		ScriptName: scriptName,
-		Latencies:  hdrhistogram.New(0, 60*60*1000000, 5),
+		Latencies:  newLatencyHistogram(r.latencyResolution),
+		Resolution: r.latencyResolution,
 	}
 	r.Scripts[scriptName] = stats
 	return stats
 }
 
-func (r *WorkerResult) record(scriptName string, latency time.Duration, outcome uowOutcome) error {
+func (r *WorkerResult) record(scriptName string, latency time.Duration, outcome uowOutcome, sampled bool) error {
 	stats, found := r.Scripts[scriptName]
 	if !found {
 		stats = &ScriptResult{
 			ScriptName: scriptName,
-			Latencies:  hdrhistogram.New(0, 60*60*1000000, 3),
+			Latencies:  newLatencyHistogram(r.latencyResolution),
+			Resolution: r.latencyResolution,
 		}
 		r.Scripts[scriptName] = stats
 	}
 
+	if outcome.waitedForSlot {
+		r.InFlightCapHits++
+	}
+
 	if outcome.succeeded {
 		stats.Succeeded++
-		if err := stats.Latencies.RecordValue(latency.Microseconds()); err != nil {
+		stats.Updates.add(outcome.updates)
+		if outcome.checksum != "" {
+			if stats.Checksums == nil {
+				stats.Checksums = make(map[string]int64)
+			}
+			countChecksum(stats.Checksums, outcome.checksum, 1)
+		}
+		if !sampled {
+			return nil
+		}
+		if err := stats.Latencies.RecordValue(int64(latency / r.latencyResolution)); err != nil {
 			return errors.Wrapf(err, "failed to record latency: %s", latency)
 		}
+		if outcome.paced {
+			if err := stats.recordScheduleWait(latency, outcome.scheduleWait); err != nil {
+				return err
+			}
+		}
+		if r.latencyBreakdown {
+			if stats.Phases == nil {
+				stats.Phases = newPhaseHistograms(r.latencyResolution)
+			}
+			if err := recordPhases(stats.Phases, outcome.phases, r.latencyResolution); err != nil {
+				return err
+			}
+		}
 	} else {
 		stats.Failed++
 		failedGroup, found := r.FailedByErrorGroup[outcome.failureGroup]
@@ -329,26 +641,90 @@ type FailureGroup struct {
 	FirstFailure error
 }
 
+// Error groups for transactions cut short by a timeout. The client giving up and the server terminating the
+// transaction call for different fixes, so these are kept apart from each other and from other failures.
+const (
+	ErrorGroupClientTimeout = "client timeout"
+	ErrorGroupServerTimeout = "server timeout"
+)
+
 func groupError(err error) string {
+	var neo4jErr *neo4j.Neo4jError
+	if errors.As(err, &neo4jErr) {
+		// Neo.ClientError.Transaction.TransactionTimedOut, when dbms.transaction.timeout or the timeout
+		// in the transaction config expires
+		if strings.HasSuffix(neo4jErr.Code, ".TransactionTimedOut") {
+			return fmt.Sprintf("%s [%s]", ErrorGroupServerTimeout, neo4jErr.Code)
+		}
+		return neo4jErr.Code
+	}
+
+	var limit *neo4j.TransactionExecutionLimit
+	if errors.As(err, &limit) {
+		if len(limit.Causes) > 0 && limit.Causes[len(limit.Causes)-1] == "Timeout" {
+			return fmt.Sprintf("%s [max transaction retry time exceeded]", ErrorGroupClientTimeout)
+		}
+		if len(limit.Errors) > 0 {
+			return groupError(limit.Errors[len(limit.Errors)-1])
+		}
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Sprintf("%s [context deadline exceeded]", ErrorGroupClientTimeout)
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return fmt.Sprintf("%s [network timeout]", ErrorGroupClientTimeout)
+	}
+
+	// The driver wraps connectivity errors in a way that hides their cause, leaving only the message to go on
 	msg := err.Error()
-	if strings.HasPrefix(msg, "Server error: [") {
-		return strings.Split(strings.Split(msg, "[")[1], "]")[0]
+	switch {
+	case strings.Contains(msg, "Timeout while waiting for connection"):
+		return fmt.Sprintf("%s [connection acquisition]", ErrorGroupClientTimeout)
+	case strings.Contains(msg, "context deadline exceeded"):
+		return fmt.Sprintf("%s [context deadline exceeded]", ErrorGroupClientTimeout)
+	case strings.Contains(msg, "i/o timeout"):
+		return fmt.Sprintf("%s [network timeout]", ErrorGroupClientTimeout)
 	}
 	return "unknown"
 }
 
 type uowOutcome struct {
 	succeeded bool
+	// Where time went in this unit of work; only set if it succeeded
+	phases phaseTimings
 	// An opaque string used to group errors; we track counts for each unique string
 	failureGroup string
 	err          error
+	// Whether this unit had to wait for a --max-in-flight slot before it could start
+	waitedForSlot bool
+	// Checksum of the rows returned, if --checksum-results is set and the unit succeeded
+	checksum string
+	// Data changed by the unit, if it succeeded
+	updates UpdateCounts
+	// Whether this unit was paced to a schedule, as in latency mode; if so, scheduleWait is how far behind
+	// schedule it was dispatched
+	paced        bool
+	scheduleWait time.Duration
 }
 
-func NewWorker(driver neo4j.Driver, workerId int64) *Worker {
+// failures may be nil; if set, the worker records the outcome of each transaction in it.
+// inFlight may be nil; if set, the worker takes a slot from it for the duration of each transaction.
+// errorRules are applied, in order, to decide the error group of failed transactions before the default grouping.
+// If livenessCheckAfter is above zero, connections idle for longer than that are checked before they are reused.
+func NewWorker(driver neo4j.Driver, workerId int64, runId string, failures *FailureStreak, inFlight *InFlightLimit,
+	errorRules ErrorRules, retriableCodes RetriableCodes, livenessCheckAfter time.Duration) *Worker {
 	return &Worker{
-		workerId: workerId,
-		driver:   driver,
-		now:      time.Now,
-		sleep:    time.Sleep,
+		workerId:           workerId,
+		runId:              runId,
+		failures:           failures,
+		inFlight:           inFlight,
+		errorRules:         errorRules,
+		retriableCodes:     retriableCodes,
+		livenessCheckAfter: livenessCheckAfter,
+		driver:             driver,
+		now:                time.Now,
+		sleep:              time.Sleep,
 	}
 }
@@ -1,11 +1,14 @@
 package neobench
 
 import (
+	"context"
 	"fmt"
 	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 	"math/rand"
 	"net/url"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -28,7 +31,7 @@ func TestMaintainsRateInFaceOfFailure(t *testing.T) {
 		now:      clock.now,
 		sleep:    clock.sleep,
 	}
-	rec := NewResultRecorder(0)
+	rec := NewResultRecorder(0, 1, nil, false, DefaultLatencyResolution)
 
 	targetRatePerSecond := float64(1)
 	txDuration := TotalRatePerSecondToDurationPerClient(1, targetRatePerSecond)
@@ -40,6 +43,143 @@ func TestMaintainsRateInFaceOfFailure(t *testing.T) {
 	assert.InDelta(t, targetRatePerSecond, sr.Rate, 0.1)
 }
 
+func TestTagsTransactionsWithMetadata(t *testing.T) {
+	r := rand.New(rand.NewSource(1337))
+	clock := &fakeSpaceTimeContinuum{currentTime: time.Date(2020, 1, 1, 1, 1, 1, 1, time.UTC)}
+	driver := &fakeDriver{clock: clock, r: r, minLatency: time.Millisecond, maxLatency: time.Millisecond}
+	w := Worker{workerId: 0, runId: "myrun", driver: driver, now: clock.now, sleep: clock.sleep}
+
+	result := w.RunBenchmark(newTestWorkload(r), "", 0, 1, make(chan struct{}), NewResultRecorder(0, 1, nil, false, DefaultLatencyResolution))
+
+	assert.NoError(t, result.Error)
+	assert.Equal(t, map[string]interface{}{
+		"neobench_script": "workertest",
+		"neobench_run":    "myrun",
+	}, driver.lastTxConfig.Metadata)
+}
+
+func TestSplitsLatencyIntoScheduleWaitAndServiceTime(t *testing.T) {
+	r := rand.New(rand.NewSource(1337))
+	clock := &fakeSpaceTimeContinuum{currentTime: time.Date(2020, 1, 1, 1, 1, 1, 1, time.UTC)}
+	// Each transaction takes 1.5s against a schedule of one per second, so each starts 0.5s later than the last
+	driver := &fakeDriver{clock: clock, r: r, minLatency: 1500 * time.Millisecond, maxLatency: 1500 * time.Millisecond}
+	w := Worker{workerId: 0, driver: driver, now: clock.now, sleep: clock.sleep}
+
+	result := w.RunBenchmark(newTestWorkload(r), "", time.Second, 10, make(chan struct{}), NewResultRecorder(0, 1, nil, false, DefaultLatencyResolution))
+
+	assert.NoError(t, result.Error)
+	sr := result.Scripts["workertest"]
+	assert.InDelta(t, 1500, sr.Millis(float64(sr.ServiceTime.Max())), 2)
+	assert.InDelta(t, 1500, sr.Millis(float64(sr.ServiceTime.Min())), 2)
+	assert.InDelta(t, 0, sr.Millis(float64(sr.ScheduleWait.Min())), 1)
+	assert.InDelta(t, 4500, sr.Millis(float64(sr.ScheduleWait.Max())), 5)
+	assert.InDelta(t, sr.Latencies.Mean(), sr.ScheduleWait.Mean()+sr.ServiceTime.Mean(), 5000)
+
+	// Without a schedule, there is nothing to wait for
+	result = w.RunBenchmark(newTestWorkload(r), "", 0, 10, make(chan struct{}), NewResultRecorder(0, 1, nil, false, DefaultLatencyResolution))
+	assert.Nil(t, result.Scripts["workertest"].ScheduleWait)
+}
+
+func TestChecksLivenessOfConnectionsIdleLongerThanThreshold(t *testing.T) {
+	tests := map[string]struct {
+		livenessCheckAfter time.Duration
+		expectChecks       int
+	}{
+		"disabled":             {livenessCheckAfter: 0, expectChecks: 0},
+		"idle below threshold": {livenessCheckAfter: time.Minute, expectChecks: 0},
+		// Not before the first transaction, since the connection hasn't been idle in our hands
+		"idle above threshold": {livenessCheckAfter: 5 * time.Second, expectChecks: 9},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			r := rand.New(rand.NewSource(1337))
+			clock := &fakeSpaceTimeContinuum{currentTime: time.Date(2020, 1, 1, 1, 1, 1, 1, time.UTC)}
+			driver := &fakeDriver{clock: clock, r: r, minLatency: time.Millisecond, maxLatency: time.Millisecond,
+				livenessLatency: 2 * time.Millisecond}
+			w := NewWorker(driver, 0, "run", nil, nil, nil, RetriableCodes{}, tc.livenessCheckAfter)
+			w.now, w.sleep = clock.now, clock.sleep
+
+			// One transaction every 10s, so the connection sits idle for just under 10s between them
+			result := w.RunBenchmark(newTestWorkload(r), "", 10*time.Second, 10, make(chan struct{}), NewResultRecorder(0, 1, nil, false, DefaultLatencyResolution))
+
+			assert.NoError(t, result.Error)
+			assert.Equal(t, int64(10), result.Scripts["workertest"].Succeeded)
+			assert.Equal(t, tc.expectChecks, driver.livenessChecks)
+			// The check is service time; the client never fell behind schedule
+			assert.Equal(t, int64(0), result.Scripts["workertest"].ScheduleWait.Max())
+			if tc.expectChecks > 0 {
+				assert.Equal(t, "run", driver.livenessTxConfig.Metadata["neobench_run"])
+				assert.Equal(t, "workertest", driver.livenessTxConfig.Metadata["neobench_script"])
+			}
+		})
+	}
+}
+
+func TestWrapsScriptsAccordingToTransactionMode(t *testing.T) {
+	tests := map[TransactionMode]struct {
+		expectManaged  int
+		expectExplicit int
+	}{
+		"":                    {expectManaged: 10},
+		TransactionManaged:    {expectManaged: 10},
+		TransactionExplicit:   {expectExplicit: 10},
+		TransactionAutocommit: {},
+	}
+
+	for mode, tc := range tests {
+		mode, tc := mode, tc
+		t.Run(string(mode), func(t *testing.T) {
+			r := rand.New(rand.NewSource(1337))
+			clock := &fakeSpaceTimeContinuum{currentTime: time.Date(2020, 1, 1, 1, 1, 1, 1, time.UTC)}
+			driver := &fakeDriver{clock: clock, r: r}
+			w := NewWorker(driver, 0, "run", nil, nil, nil, RetriableCodes{}, 0)
+			w.now, w.sleep = clock.now, clock.sleep
+			script, err := Parse("nostatements", `:set a 1`, 1)
+			assert.NoError(t, err)
+			wrk := ClientWorkload{Scripts: NewScripts(script), Rand: r, TransactionMode: mode}
+
+			result := w.RunBenchmark(wrk, "", 0, 10, make(chan struct{}), NewResultRecorder(0, 1, nil, false, DefaultLatencyResolution))
+
+			assert.NoError(t, result.Error)
+			assert.Equal(t, int64(10), result.Scripts["nostatements"].Succeeded)
+			assert.Equal(t, tc.expectManaged, driver.managedTransactions)
+			assert.Equal(t, tc.expectExplicit, driver.explicitTransactions)
+			assert.Equal(t, tc.expectExplicit, driver.commits)
+		})
+	}
+}
+
+func TestRetriesManagedTransactionsOnRetriableCodes(t *testing.T) {
+	busy := &neo4j.Neo4jError{Code: "MyProc.Busy", Msg: "try again"}
+	codes, err := ParseRetriableCodes([]string{"MyProc.Busy"})
+	assert.NoError(t, err)
+	tests := map[string]struct {
+		codes           RetriableCodes
+		expectSucceeded int64
+		expectAttempts  int
+	}{
+		"left to the driver":   {codes: RetriableCodes{}, expectSucceeded: 0, expectAttempts: 1},
+		"retriable code given": {codes: codes, expectSucceeded: 1, expectAttempts: 3},
+	}
+
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			r := rand.New(rand.NewSource(1337))
+			clock := &fakeSpaceTimeContinuum{currentTime: time.Date(2020, 1, 1, 1, 1, 1, 1, time.UTC)}
+			driver := &fakeDriver{clock: clock, r: r, errs: []error{busy, busy}}
+			w := NewWorker(driver, 0, "run", nil, nil, nil, tc.codes, 0)
+			w.now, w.sleep = clock.now, clock.sleep
+
+			result := w.RunBenchmark(newTestWorkload(r), "", 0, 1, make(chan struct{}), NewResultRecorder(0, 1, nil, false, DefaultLatencyResolution))
+
+			assert.NoError(t, result.Error)
+			assert.Equal(t, tc.expectSucceeded, result.Scripts["workertest"].Succeeded)
+			assert.Equal(t, tc.expectAttempts, driver.managedTransactions)
+		})
+	}
+}
+
 func newTestWorkload(r *rand.Rand) ClientWorkload {
 	script, err := Parse("workertest", `RETURN 1;`, 1)
 	if err != nil {
@@ -71,6 +211,19 @@ type fakeDriver struct {
 	failureRate float64
 	minLatency  time.Duration
 	maxLatency  time.Duration
+	// Config of the last transaction run
+	lastTxConfig neo4j.TransactionConfig
+	// Number of queries run outside of transactions, which the worker only does to check liveness, how long
+	// each takes, and the config of the last one
+	livenessChecks   int
+	livenessLatency  time.Duration
+	livenessTxConfig neo4j.TransactionConfig
+	// Number of transaction functions and explicit transactions run, and explicit transactions committed
+	managedTransactions  int
+	explicitTransactions int
+	commits              int
+	// Errors for the next transaction functions to fail with, in order, before any induced by failureRate
+	errs []error
 }
 
 func (d *fakeDriver) VerifyConnectivity() error {
@@ -98,7 +251,8 @@ func (d *fakeDriver) LastBookmark() string {
 }
 
 func (d *fakeDriver) BeginTransaction(configurers ...func(*neo4j.TransactionConfig)) (neo4j.Transaction, error) {
-	panic("implement me")
+	d.explicitTransactions++
+	return &fakeTransaction{driver: d}, nil
 }
 
 func (d *fakeDriver) ReadTransaction(work neo4j.TransactionWork, configurers ...func(*neo4j.TransactionConfig)) (interface{}, error) {
@@ -106,6 +260,16 @@ func (d *fakeDriver) ReadTransaction(work neo4j.TransactionWork, configurers ...
 }
 
 func (d *fakeDriver) WriteTransaction(work neo4j.TransactionWork, configurers ...func(*neo4j.TransactionConfig)) (interface{}, error) {
+	d.managedTransactions++
+	d.lastTxConfig = neo4j.TransactionConfig{}
+	for _, c := range configurers {
+		c(&d.lastTxConfig)
+	}
+	if len(d.errs) > 0 {
+		err := d.errs[0]
+		d.errs = d.errs[1:]
+		return nil, err
+	}
 	if d.r.Float64() <= d.failureRate {
 		return nil, fmt.Errorf("induced error from test harness")
 	}
@@ -118,10 +282,170 @@ func (d *fakeDriver) WriteTransaction(work neo4j.TransactionWork, configurers ..
 	return nil, nil
 }
 
+// Only used for liveness checks; fails as if the connection had gone stale, so there's no result to fake
 func (d *fakeDriver) Run(cypher string, params map[string]interface{}, configurers ...func(*neo4j.TransactionConfig)) (neo4j.Result, error) {
+	d.livenessChecks++
+	d.livenessTxConfig = neo4j.TransactionConfig{}
+	for _, c := range configurers {
+		c(&d.livenessTxConfig)
+	}
+	d.clock.sleep(d.livenessLatency)
+	return nil, errors.New("connection is stale")
+}
+
+// Explicit transaction that runs nothing, for scripts without statements
+type fakeTransaction struct {
+	driver *fakeDriver
+}
+
+func (tx *fakeTransaction) Run(cypher string, params map[string]interface{}) (neo4j.Result, error) {
 	panic("implement me")
 }
 
+func (tx *fakeTransaction) Commit() error {
+	tx.driver.commits++
+	return nil
+}
+
+func (tx *fakeTransaction) Rollback() error {
+	return nil
+}
+
+func (tx *fakeTransaction) Close() error {
+	return nil
+}
+
 var _ neo4j.Driver = &fakeDriver{}
 
 var _ neo4j.Session = &fakeDriver{}
+
+func TestSamplesLatenciesButCountsAllTransactions(t *testing.T) {
+	rec := NewResultRecorder(0, 0.1, rand.New(rand.NewSource(1337)), false, DefaultLatencyResolution)
+	rec.totalStart = time.Date(2020, 1, 1, 1, 1, 1, 1, time.UTC)
+
+	for i := 0; i < 100000; i++ {
+		assert.NoError(t, rec.record("sampled", time.Millisecond, uowOutcome{succeeded: true}))
+	}
+	result := rec.Complete(rec.totalStart.Add(time.Second))
+
+	sr := result.Scripts["sampled"]
+	assert.Equal(t, int64(100000), sr.Succeeded)
+	assert.InDelta(t, 100000.0, sr.Rate, 0.1)
+	assert.InDelta(t, 10000, sr.Latencies.TotalCount(), 500)
+	assert.Equal(t, 0.1, result.LatencySampleRate)
+}
+
+func TestResetDiscardsWarmupResults(t *testing.T) {
+	rec := NewResultRecorder(0, 1, nil, false, DefaultLatencyResolution)
+	start := time.Date(2020, 1, 1, 1, 1, 1, 1, time.UTC)
+	rec.Reset(start)
+
+	for i := 0; i < 10; i++ {
+		assert.NoError(t, rec.record("warmup", time.Millisecond, uowOutcome{succeeded: true}))
+	}
+	measurementStart := start.Add(time.Minute)
+	rec.Reset(measurementStart)
+	for i := 0; i < 5; i++ {
+		assert.NoError(t, rec.record("measured", time.Millisecond, uowOutcome{succeeded: true}))
+	}
+	result := rec.Complete(measurementStart.Add(time.Second))
+
+	assert.NotContains(t, result.Scripts, "warmup")
+	assert.Equal(t, int64(5), result.Scripts["measured"].Succeeded)
+	assert.InDelta(t, 5.0, result.Scripts["measured"].Rate, 0.01)
+	assert.Equal(t, int64(5), rec.Completed())
+}
+
+func TestCountsContentionBetweenRecordingAndReading(t *testing.T) {
+	rec := NewResultRecorder(0, 1, nil, false, DefaultLatencyResolution)
+	assert.NoError(t, rec.record("uncontended", time.Millisecond, uowOutcome{succeeded: true}))
+	rec.ProgressReport(time.Now())
+	recordBlocked, readBlocked := rec.Contention()
+	assert.Equal(t, int64(0), recordBlocked)
+	assert.Equal(t, int64(0), readBlocked)
+
+	// Hold the lock as a reader would, while the worker tries to record
+	rec.lock(&rec.readBlocked)
+	recorded := make(chan error)
+	go func() {
+		recorded <- rec.record("contended", time.Millisecond, uowOutcome{succeeded: true})
+	}()
+	for atomic.LoadInt32(&rec.lockers) < 2 {
+		time.Sleep(time.Millisecond)
+	}
+	rec.unlock()
+	assert.NoError(t, <-recorded)
+
+	recordBlocked, readBlocked = rec.Contention()
+	assert.Equal(t, int64(1), recordBlocked)
+	assert.Equal(t, int64(0), readBlocked)
+}
+
+func TestGroupErrorSeparatesClientAndServerTimeouts(t *testing.T) {
+	serverTimeout := &neo4j.Neo4jError{Code: "Neo.ClientError.Transaction.TransactionTimedOut", Msg: "terminated"}
+	tests := map[string]struct {
+		err      error
+		expected string
+	}{
+		"server timeout": {
+			err:      serverTimeout,
+			expected: "server timeout [Neo.ClientError.Transaction.TransactionTimedOut]",
+		},
+		"other server error": {
+			err:      &neo4j.Neo4jError{Code: "Neo.TransientError.Transaction.DeadlockDetected"},
+			expected: "Neo.TransientError.Transaction.DeadlockDetected",
+		},
+		"retries timed out": {
+			err: &neo4j.TransactionExecutionLimit{
+				Errors: []error{&neo4j.Neo4jError{Code: "Neo.TransientError.Transaction.DeadlockDetected"}},
+				Causes: []string{"Transient error", "Timeout"},
+			},
+			expected: "client timeout [max transaction retry time exceeded]",
+		},
+		"retry limit hit for other reasons": {
+			err: &neo4j.TransactionExecutionLimit{
+				Errors: []error{serverTimeout},
+				Causes: []string{"Transient error"},
+			},
+			expected: "server timeout [Neo.ClientError.Transaction.TransactionTimedOut]",
+		},
+		"context deadline": {
+			err:      errors.Wrap(context.DeadlineExceeded, "running query"),
+			expected: "client timeout [context deadline exceeded]",
+		},
+		"connection acquisition": {
+			err:      fmt.Errorf("ConnectivityError: Timeout while waiting for connection to any of [[localhost:7687]]: context deadline exceeded"),
+			expected: "client timeout [connection acquisition]",
+		},
+		"unknown": {
+			err:      fmt.Errorf("something else"),
+			expected: "unknown",
+		},
+	}
+
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, groupError(tc.err))
+		})
+	}
+}
+
+func TestRecordsLatenciesAtConfiguredResolution(t *testing.T) {
+	for _, resolution := range []time.Duration{time.Nanosecond, time.Microsecond} {
+		rec := NewResultRecorder(0, 1, nil, false, resolution)
+		rec.Reset(time.Date(2020, 1, 1, 1, 1, 1, 1, time.UTC))
+		assert.NoError(t, rec.record("fast", 1500*time.Nanosecond, uowOutcome{succeeded: true}))
+		assert.NoError(t, rec.record("slow", 250*time.Millisecond, uowOutcome{succeeded: true}))
+		result := NewResult("neo4j", "")
+		result.Add(rec.Complete(rec.totalStart.Add(time.Second)))
+
+		fast, slow := result.Scripts["fast"], result.Scripts["slow"]
+		assert.InDelta(t, 250, slow.Millis(slow.Latencies.Mean()), 0.5, resolution.String())
+		if resolution == time.Nanosecond {
+			assert.InDelta(t, 0.0015, fast.Millis(fast.Latencies.Mean()), 0.00001)
+		} else {
+			assert.InDelta(t, 0.001, fast.Millis(fast.Latencies.Mean()), 0.00001)
+		}
+	}
+}
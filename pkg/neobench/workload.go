@@ -19,11 +19,23 @@ const WorkerIdVar = "nbWorkerId"
 type Workload struct {
 	// set on command line and built in
 	Variables map[string]interface{}
+	// If set, clients run their sessions in read access mode, see --read-only
+	Readonly bool
+	// If set, clients checksum the rows returned by each transaction, see --checksum-results
+	ChecksumResults ChecksumMode
+	// How clients wrap scripts in transactions, see --transaction-mode; empty means TransactionManaged
+	TransactionMode TransactionMode
 
 	Scripts Scripts
 
 	Rand      *rand.Rand
 	CsvLoader *CsvLoader
+	// Shared by all clients, so sequence() values are unique across them
+	Sequences *Sequences
+	// If set, clients write each unit of work they run to it, see --record-params
+	RecordParams *ParamsRecorder
+	// If set, clients run the recorded units of work from it rather than evaluating scripts, see --replay-params
+	ReplayParams *ParamsReplay
 }
 
 // Scripts in a workload, and utilities to draw a weighted random script
@@ -47,6 +59,21 @@ func NewScripts(scripts ...Script) Scripts {
 	}
 }
 
+func (s *Scripts) Names() []string {
+	out := make([]string, 0, len(s.Scripts))
+	for _, script := range s.Scripts {
+		out = append(out, script.Name)
+	}
+	return out
+}
+
+func (s *Scripts) TotalWeight() (total float64) {
+	for _, script := range s.Scripts {
+		total += script.Weight
+	}
+	return
+}
+
 func (s *Scripts) Choose(r *rand.Rand) Script {
 	return s.WeightedLookup.Draw(r).(Script)
 }
@@ -120,6 +147,7 @@ type ScriptContext struct {
 	Vars          map[string]interface{}
 	Rand          *rand.Rand
 	CsvLoader     *CsvLoader
+	Sequences     *ClientSequences
 }
 
 // Evaluate this script in the given context
@@ -140,35 +168,74 @@ func (s *Script) Eval(ctx ScriptContext) (UnitOfWork, error) {
 	return uow, nil
 }
 
+// Splits the workload into one workload per script, for running each script with its own workers, see
+// --isolate-scripts. The workloads share variables and the CSV loader; each gets its own random source.
+func (s *Workload) Isolate() []Workload {
+	out := make([]Workload, 0, len(s.Scripts.Scripts))
+	for _, script := range s.Scripts.Scripts {
+		isolated := *s
+		isolated.Scripts = NewScripts(script)
+		isolated.Rand = rand.New(rand.NewSource(s.Rand.Int63()))
+		out = append(out, isolated)
+	}
+	return out
+}
+
 func (s *Workload) NewClient() ClientWorkload {
 	return ClientWorkload{
-		Variables: s.Variables,
-		Scripts:   s.Scripts,
-		Rand:      rand.New(rand.NewSource(s.Rand.Int63())),
-		Stderr:    os.Stderr,
-		CsvLoader: s.CsvLoader,
+		Readonly:        s.Readonly,
+		ChecksumResults: s.ChecksumResults,
+		TransactionMode: s.TransactionMode,
+		Variables:       s.Variables,
+		Scripts:         s.Scripts,
+		Rand:            rand.New(rand.NewSource(s.Rand.Int63())),
+		Stderr:          os.Stderr,
+		CsvLoader:       s.CsvLoader,
+		Sequences:       s.Sequences.ForClient(),
+		RecordParams:    s.RecordParams,
+		ReplayParams:    s.ReplayParams,
 	}
 }
 
 type ClientWorkload struct {
-	Readonly bool
+	Readonly        bool
+	ChecksumResults ChecksumMode
+	TransactionMode TransactionMode
 	// variables set on command line and built-in
 	Variables map[string]interface{}
 	Scripts   Scripts
 	Rand      *rand.Rand
 	Stderr    io.Writer
 	CsvLoader *CsvLoader
+	Sequences *ClientSequences
+	// See Workload
+	RecordParams *ParamsRecorder
+	ReplayParams *ParamsReplay
 }
 
+// The next unit of work to run; ErrParamsExhausted once a replay has run out of recorded units
 func (s *ClientWorkload) Next(workerId int64) (UnitOfWork, error) {
-	script := s.Scripts.Choose(s.Rand)
-	return script.Eval(ScriptContext{
-		Script:    script,
-		Stderr:    s.Stderr,
-		Vars:      createVars(s.Variables, workerId),
-		Rand:      s.Rand,
-		CsvLoader: s.CsvLoader,
-	})
+	var uow UnitOfWork
+	var err error
+	if s.ReplayParams != nil {
+		uow, err = s.ReplayParams.next(s.Scripts)
+	} else {
+		script := s.Scripts.Choose(s.Rand)
+		uow, err = script.Eval(ScriptContext{
+			Script:    script,
+			Stderr:    s.Stderr,
+			Vars:      createVars(s.Variables, workerId),
+			Rand:      s.Rand,
+			CsvLoader: s.CsvLoader,
+			Sequences: s.Sequences,
+		})
+	}
+	if err == nil && s.RecordParams != nil {
+		err = s.RecordParams.record(uow)
+	}
+	uow.ChecksumResults = s.ChecksumResults
+	uow.TransactionMode = s.TransactionMode
+	return uow, err
 }
 
 type UnitOfWork struct {
@@ -177,6 +244,9 @@ type UnitOfWork struct {
 	Readonly   bool
 	Statements []Statement
 	Autocommit bool
+	// How to checksum the rows the statements return, if at all
+	ChecksumResults ChecksumMode
+	TransactionMode TransactionMode
 }
 
 type Statement struct {
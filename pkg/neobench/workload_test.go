@@ -48,3 +48,27 @@ func TestChooseWeightedWorkload(t *testing.T) {
 	assert.InDelta(t, b.Weight, bNorm, maxDiffOnB, "seed=%d", seed)
 	assert.InDelta(t, c.Weight, cNorm, maxDiffOnC, "seed=%d", seed)
 }
+
+func TestIsolateSplitsWorkloadByScript(t *testing.T) {
+	wrk := Workload{
+		Variables: map[string]interface{}{"scale": int64(1)},
+		Scripts:   NewScripts(Script{Name: "a", Weight: 1}, Script{Name: "b", Weight: 3}),
+		Rand:      rand.New(rand.NewSource(1337)),
+	}
+
+	isolated := wrk.Isolate()
+
+	assert.Len(t, isolated, 2)
+	for i, name := range []string{"a", "b"} {
+		assert.Equal(t, []string{name}, isolated[i].Scripts.Names())
+		assert.Equal(t, wrk.Variables, isolated[i].Variables)
+		client := isolated[i].NewClient()
+		for j := 0; j < 10; j++ {
+			uow, err := client.Next(0)
+			assert.NoError(t, err)
+			assert.Equal(t, name, uow.ScriptName)
+		}
+	}
+	assert.Equal(t, 4.0, wrk.Scripts.TotalWeight())
+	assert.Equal(t, 3.0, isolated[1].Scripts.TotalWeight())
+}
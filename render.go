@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"github.com/spf13/pflag"
+	"io"
+	"log"
+	"neobench/pkg/neobench"
+	"os"
+	"strings"
+)
+
+// `neobench render` loads a result saved with --save-result and renders it through an output, without running
+// anything against a database; useful for producing a report in another format from an earlier run.
+func render(args []string) int {
+	flags := pflag.NewFlagSet("render", pflag.ExitOnError)
+	input := flags.String("input", "", "result or suite file to render, written by --save-result")
+	outputFormat := flags.StringP("output", "o", "interactive", "output format to render with, `interactive`, `csv`, `ndjson`, `json` or `html`")
+	csvColumns := flags.StringSlice("csv-columns", nil, "in csv output, write only these latency columns, in this order")
+	jsonQuantiles := flags.Float64Slice("json-quantiles", nil, "in json output, the latency percentiles to report")
+	csvMetadata := flags.Bool("csv-metadata", false, "in csv output, start with # comment lines recording the scenario, render time, neobench version and database")
+	locale := flags.String("locale", "", "locale to format numbers in, in interactive output; taken from the environment if not set")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, `Renders a result, or a suite, saved with --save-result.
+
+Usage:
+  neobench render --input FILE [--output FORMAT]
+
+Options:
+`)
+		flags.PrintDefaults()
+	}
+	_ = flags.Parse(args)
+	if *input == "" {
+		flags.Usage()
+		return 1
+	}
+
+	f, err := os.Open(*input)
+	if err != nil {
+		log.Printf("failed to open saved result: %s", err)
+		return 1
+	}
+	defer f.Close()
+	// A single result is rendered as a suite of one, without the suite report
+	suite := neobench.NewSuiteResult()
+	result, latencyMode, err := neobench.LoadResult(f)
+	isSuite := err == neobench.ErrSavedSuite
+	if isSuite {
+		if _, err = f.Seek(0, io.SeekStart); err == nil {
+			suite, latencyMode, err = neobench.LoadSuite(f)
+		}
+	} else if err == nil {
+		suite.Add("", result)
+	}
+	if err != nil {
+		log.Printf("%s: %s", *input, err)
+		return 1
+	}
+	if isSuite && *outputFormat == "html" {
+		log.Printf("html output is a report of a single result, but %s is a suite with one per workload", *input)
+		return 1
+	}
+
+	out, err := neobench.InitOutput(*outputFormat, neobench.OutputOptions{OutStream: os.Stdout, Version: version, CsvColumns: *csvColumns,
+		CsvMetadata: *csvMetadata, JsonQuantiles: *jsonQuantiles, Locale: *locale})
+	if err != nil {
+		log.Printf("%s", err)
+		return 1
+	}
+
+	// Outputs write their headers on BenchmarkStart, so it's called as for a run; saved results don't record the
+	// url the run was against
+	first := suite.Workloads[suite.Names[0]]
+	scenario := first.Scenario
+	if isSuite {
+		scenario = " suite " + strings.Join(suite.Names, " ")
+	}
+	out.BenchmarkStart(first.DatabaseName, "unknown", scenario)
+
+	for _, name := range suite.Names {
+		if latencyMode {
+			out.ReportLatency(suite.Workloads[name])
+		} else {
+			out.ReportThroughput(suite.Workloads[name])
+		}
+	}
+	if isSuite {
+		neobench.ReportSuite(out, suite, latencyMode)
+	}
+	if closer, ok := out.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			log.Printf("%s", err)
+			return 1
+		}
+	}
+	return 0
+}
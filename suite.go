@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
+	"github.com/spf13/pflag"
+	"log"
+	"neobench/pkg/neobench"
+	"os"
+	"strings"
+)
+
+// Workload files given to `neobench suite`, and the database to run them against
+var suiteFiles []string
+var fSuiteDatabase string
+
+// `neobench suite` takes the same options as a normal run, but runs each of the given workload files on its own,
+// one after the other, and ends with a combined report; see runSuite
+func parseSuiteArgs(args []string) {
+	flags := pflag.NewFlagSet("suite", pflag.ExitOnError)
+	flags.AddFlagSet(pflag.CommandLine)
+	flags.StringVar(&fSuiteDatabase, "database", "", "database to run the suite against, the default database if not set")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, `Runs workload files one after the other, each through the full --warmup, --duration and
+--cooldown, reporting each on its own and then all of them together.
+
+Usage:
+  neobench suite [OPTION]... FILE...
+
+Options:
+`)
+		flags.PrintDefaults()
+	}
+	_ = flags.Parse(args)
+	suiteFiles = flags.Args()
+	if len(suiteFiles) == 0 {
+		flags.Usage()
+		os.Exit(1)
+	}
+
+	seen := make(map[string]string)
+	for _, path := range suiteFiles {
+		name := neobench.SuiteWorkloadName(path)
+		if other, found := seen[name]; found {
+			log.Fatalf("workloads in a suite are named after their files, so %s and %s can't both be in it", other, path)
+		}
+		seen[name] = path
+	}
+	if len(fBuiltinWorkloads) > 0 || len(fWorkloadFiles) > 0 || len(fWorkloadScripts) > 0 {
+		log.Fatalf("neobench suite runs the workload files it is given, so it can't be combined with -b, -f or -S")
+	}
+	if fSequential || fReplayParams != "" || fInitMode {
+		log.Fatalf("neobench suite can't be combined with --sequential, --replay-params or --init")
+	}
+	if fOutputFormat == "html" {
+		log.Fatalf("html output is a report of a single result, but neobench suite produces one per workload")
+	}
+}
+
+// Runs each workload of the suite through its own benchmark, sharing the driver and so the connection pool, and
+// returns the exit code. Like --sequential, an interrupt stops the workload running at the time and skips the rest.
+func runSuite(driver neo4j.Driver, newDriver func() (neo4j.Driver, error), dbName string, variables map[string]interface{},
+	seed int64, out neobench.Output) int {
+	stopCh, stop := neobench.SetupSignalHandler()
+	defer stop()
+
+	out.BenchmarkStart(dbName, fAddress, fmt.Sprintf(" suite%s %s", describeScenario(), strings.Join(suiteFiles, " "))+
+		describeScenarioNote(fScenarioNote))
+
+	exitCode := 0
+	suite := neobench.NewSuiteResult()
+	for _, path := range suiteFiles {
+		select {
+		case <-stopCh:
+			out.Errorf("interrupted, skipping the remaining workloads")
+			return 1
+		default:
+		}
+		wrk, err := createWorkload(driver, dbName, variables, seed, nil, []string{path}, nil)
+		if err != nil {
+			out.Errorf("%s", err)
+			return 1
+		}
+		pools, err := planWorkerPools(driver, newDriver, wrk)
+		if err != nil {
+			out.Errorf("%s", err)
+			return 1
+		}
+		scenario := fmt.Sprintf(" -f %s", path) + describeScenario() + describeScenarioNote(fScenarioNote)
+		result, err := runBenchmark(pools, dbName, scenario, out, fWarmup, fDuration, fCooldown, fLatencyMode, fProgress)
+		if err != nil {
+			out.Errorf(err.Error())
+			return 1
+		}
+		if fLatencyMode {
+			out.ReportLatency(result)
+		} else {
+			out.ReportThroughput(result)
+		}
+		if result.TotalFailed() > 0 || !meetsLatencyTargets(result, out) {
+			exitCode = 1
+		}
+		profileSlowest(driver, dbName, wrk, result, out)
+		suite.Add(neobench.SuiteWorkloadName(path), result)
+	}
+	neobench.ReportSuite(out, suite, fLatencyMode)
+	saveSuite(suite, fLatencyMode, out)
+	return exitCode
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"github.com/spf13/pflag"
+	"golang.org/x/term"
+	"log"
+	"neobench/pkg/neobench"
+	"os"
+	"time"
+)
+
+// `neobench watch` follows a running neobench through its --prometheus endpoint, showing a table of its
+// transaction rates that refreshes in place; for a quick look at a long run without setting up Grafana.
+func watch(args []string) int {
+	flags := pflag.NewFlagSet("watch", pflag.ExitOnError)
+	addr := flags.String("prometheus-url", "", "address the neobench to watch publishes metrics at, as given to its --prometheus, ex: localhost:1234, or the full url of the metrics endpoint")
+	interval := flags.Duration("interval", 2*time.Second, "how often to refresh the table")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, `Follows the metrics of a neobench running with --prometheus.
+
+Usage:
+  neobench watch --prometheus-url HOST:PORT [--interval DURATION]
+
+Options:
+`)
+		flags.PrintDefaults()
+	}
+	_ = flags.Parse(args)
+	if *addr == "" || *interval <= 0 {
+		flags.Usage()
+		return 1
+	}
+
+	stopCh, stop := neobench.SetupSignalHandler()
+	defer stop()
+	watcher := neobench.NewWatcher(*addr)
+	// Redraw in place on a terminal, otherwise append, so the output can be logged
+	redraw := term.IsTerminal(int(os.Stdout.Fd()))
+	var prev neobench.WatchSample
+	for {
+		cur, err := watcher.Sample()
+		if redraw {
+			fmt.Print("\033[H\033[2J")
+		}
+		fmt.Printf("neobench watch %s, %s\n\n", watcher.Url(), time.Now().Format("15:04:05"))
+		if err != nil {
+			// The run may not have started yet, or have ended; keep trying until interrupted
+			fmt.Printf("%s\n", err)
+		} else {
+			if err := neobench.WriteWatchTable(os.Stdout, prev, cur); err != nil {
+				log.Printf("%s", err)
+				return 1
+			}
+			prev = cur
+		}
+		fmt.Println()
+
+		select {
+		case <-stopCh:
+			return 0
+		case <-time.After(*interval):
+		}
+	}
+}